@@ -0,0 +1,116 @@
+package accounts
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	"s2dnglobby/config"
+	"s2dnglobby/library"
+)
+
+var log = library.GetLogger("Accounts")
+
+var ErrUserExists = errors.New("user already exists")
+var ErrAuthFailed = errors.New("authentication failed")
+
+type Record struct {
+	Name      string
+	Salt      string
+	Hash      string
+	Created   time.Time
+	LastLogin time.Time
+}
+
+// Identity is the result of a successful login or registration
+type Identity struct {
+	Name  string
+	Uid   uint32
+	Guest bool
+}
+
+type Store interface {
+	// Create registers a new account, fails with ErrUserExists
+	Create(name, password string) (*Record, error)
+	// Authenticate checks the credentials, fails with ErrAuthFailed
+	Authenticate(name, password string) (*Record, error)
+	Get(name string) (*Record, bool)
+}
+
+var store Store
+
+func InitAccounts() error {
+	r, err := loadUidRegistry(filepath.Join(config.DataDir, "userids.json"))
+	if err != nil {
+		return err
+	}
+	uids = r
+
+	if err := initKeys(); err != nil {
+		return err
+	}
+	if err := initFriends(); err != nil {
+		return err
+	}
+
+	if config.Cfg.AccountMode == config.AccountModeOpen {
+		log.Infoln("Running in open mode, all credentials get accepted")
+		return nil
+	}
+
+	s, err := NewFileStore(filepath.Join(config.DataDir, "accounts.json"))
+	if err != nil {
+		return err
+	}
+	store = s
+
+	log.Infoln("Accounts initialized")
+	return nil
+}
+
+func SetStore(s Store) {
+	store = s
+}
+
+// Register creates a new account, in open mode this always succeeds
+func Register(name, password string) (*Identity, error) {
+	if store != nil {
+		if _, err := store.Create(name, password); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Identity{
+		Name: name,
+		Uid:  uids.uidFor(name),
+	}, nil
+}
+
+// Login checks the credentials, in open mode this always succeeds.
+// Unknown accounts are logged in as guests if AllowGuests is set.
+func Login(name, password string) (*Identity, error) {
+	if store == nil {
+		return &Identity{
+			Name: name,
+			Uid:  uids.uidFor(name),
+		}, nil
+	}
+
+	if _, ok := store.Get(name); !ok && config.Cfg.AllowGuests {
+		return &Identity{
+			Name:  name,
+			Uid:   NextGuestUid(),
+			Guest: true,
+		}, nil
+	}
+
+	r, err := store.Authenticate(name, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{
+		Name: r.Name,
+		Uid:  uids.uidFor(r.Name),
+	}, nil
+}
@@ -0,0 +1,242 @@
+package accounts
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"s2dnglobby/config"
+	"s2dnglobby/library"
+)
+
+var ErrInvalidKey = errors.New("invalid CD key")
+var ErrKeyLimit = errors.New("CD key is used by too many accounts")
+
+/*
+* The client sends the CD key obfuscated as 16 bytes plus null terminator.
+* How the obfuscation works is unknown, so validators work on the raw bytes.
+ */
+
+const keyLength = 16
+
+type KeyValidator interface {
+	Validate(key []byte, keypool uint16) error
+}
+
+// AcceptAll accepts every key
+type AcceptAll struct{}
+
+func (AcceptAll) Validate(key []byte, keypool uint16) error {
+	return nil
+}
+
+// FormatValidator only rejects malformed keys. The key algorithm is unknown,
+// so there is no checksum and made up keys of the right form pass.
+type FormatValidator struct{}
+
+func (v FormatValidator) Validate(key []byte, keypool uint16) error {
+	key = trimKey(key)
+
+	if len(key) != keyLength {
+		return fmt.Errorf("%w: wrong length %d", ErrInvalidKey, len(key))
+	}
+	if bytes.IndexByte(key, 0) >= 0 {
+		return fmt.Errorf("%w: contains null bytes", ErrInvalidKey)
+	}
+	if bytes.Count(key, key[:1]) == len(key) {
+		return fmt.Errorf("%w: all bytes are the same", ErrInvalidKey)
+	}
+	return nil
+}
+
+// AllowlistValidator accepts keys listed in a file,
+// one hex encoded key (as sent by the client) per line
+type AllowlistValidator struct {
+	keys map[string]bool
+}
+
+func NewAllowlistValidator(path string) (*AllowlistValidator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key allowlist: %w", err)
+	}
+	defer f.Close()
+
+	v := &AllowlistValidator{keys: make(map[string]bool)}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, err := hex.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key in allowlist: %s", line)
+		}
+		v.keys[string(trimKey(key))] = true
+	}
+
+	return v, scanner.Err()
+}
+
+func (v *AllowlistValidator) Validate(key []byte, keypool uint16) error {
+	if !v.keys[string(trimKey(key))] {
+		return fmt.Errorf("%w: not in allowlist", ErrInvalidKey)
+	}
+	return nil
+}
+
+func newKeyValidator() (KeyValidator, error) {
+	switch config.Cfg.KeyValidator {
+	case config.KeyValidatorAll:
+		return AcceptAll{}, nil
+	case config.KeyValidatorFormat:
+		return FormatValidator{}, nil
+	case config.KeyValidatorAllowlist:
+		return NewAllowlistValidator(config.Cfg.KeyAllowlistFile)
+	}
+	return nil, fmt.Errorf("unknown KeyValidator: %s", config.Cfg.KeyValidator)
+}
+
+func trimKey(key []byte) []byte {
+	return bytes.TrimRight(key, "\x00")
+}
+
+/* key to account binding */
+
+// keyBindings maps the hashed key to the accounts using it
+type keyBindings struct {
+	path     string
+	reserved map[string]int // slots held by logins in progress, by hash
+	lock     sync.Mutex
+
+	Keys map[string][]string
+}
+
+var validator KeyValidator = AcceptAll{}
+var bindings = &keyBindings{Keys: make(map[string][]string), reserved: make(map[string]int)}
+
+func initKeys() error {
+	v, err := newKeyValidator()
+	if err != nil {
+		return err
+	}
+	validator = v
+
+	b := &keyBindings{
+		path:     filepath.Join(config.DataDir, "cdkeys.json"),
+		reserved: make(map[string]int),
+		Keys:     make(map[string][]string),
+	}
+	if err := library.ReadJSON(b.path, b); err != nil {
+		return fmt.Errorf("failed to load CD key bindings: %w", err)
+	}
+	if b.Keys == nil {
+		b.Keys = make(map[string][]string)
+	}
+	bindings = b
+
+	return nil
+}
+
+// HashKey is used to store keys, the keys themselves never hit the disk
+func HashKey(key []byte) string {
+	sum := sha256.Sum256(trimKey(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidateKey checks the key with the configured validator, fails with ErrInvalidKey
+func ValidateKey(key []byte, keypool uint16) error {
+	return validator.Validate(key, keypool)
+}
+
+// KeyClaim is a slot of a CD key reserved for a login in progress,
+// it has to be bound or released
+type KeyClaim struct {
+	hash     string
+	account  string
+	reserved bool
+}
+
+// ReserveKey checks that the account may use the key and holds a slot for it
+// until the credentials are checked, fails with ErrKeyLimit. Reserved slots count
+// towards MaxAccountsPerKey, so concurrent logins cannot exceed it.
+func ReserveKey(key []byte, name string) (*KeyClaim, error) {
+	c := &KeyClaim{hash: HashKey(key), account: library.NormalizeName(name)}
+	limit := config.Cfg.MaxAccountsPerKey
+
+	bindings.lock.Lock()
+	defer bindings.lock.Unlock()
+
+	if limit > 0 && !bindings.bound(c.hash, c.account) {
+		if len(bindings.Keys[c.hash])+bindings.reserved[c.hash] >= limit {
+			return nil, ErrKeyLimit
+		}
+		bindings.reserved[c.hash]++
+		c.reserved = true
+	}
+	return c, nil
+}
+
+// Bind binds the key to the account for good
+func (c *KeyClaim) Bind() {
+	bindings.lock.Lock()
+	defer bindings.lock.Unlock()
+
+	c.release()
+	bindings.bind(c.hash, c.account)
+}
+
+// Release gives the slot back, does nothing after Bind
+func (c *KeyClaim) Release() {
+	bindings.lock.Lock()
+	defer bindings.lock.Unlock()
+
+	c.release()
+}
+
+// release has to be called with the lock held
+func (c *KeyClaim) release() {
+	if !c.reserved {
+		return
+	}
+	c.reserved = false
+
+	if bindings.reserved[c.hash]--; bindings.reserved[c.hash] <= 0 {
+		delete(bindings.reserved, c.hash)
+	}
+}
+
+// bound has to be called with the lock held
+func (b *keyBindings) bound(hash, account string) bool {
+	for _, n := range b.Keys[hash] {
+		if n == account {
+			return true
+		}
+	}
+	return false
+}
+
+// bind remembers that the account uses the key, has to be called with the lock held
+func (b *keyBindings) bind(hash, account string) {
+	if b.bound(hash, account) {
+		return
+	}
+	b.Keys[hash] = append(b.Keys[hash], account)
+
+	if b.path == "" {
+		return
+	}
+	if err := library.WriteJSON(b.path, b); err != nil {
+		log.Errorln("Failed to store CD key bindings:", err)
+	}
+}
@@ -0,0 +1,109 @@
+package accounts_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"s2dnglobby/accounts"
+	"s2dnglobby/config"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// key as sent in RequestLogin, including the null terminator
+const dumpKey = "BCA2BCA3B7BA9C9EBBA7949F9794878000"
+
+func TestFormatValidator(t *testing.T) {
+	v := accounts.FormatValidator{}
+
+	key, _ := hex.DecodeString(dumpKey)
+	if err := v.Validate(key, 1); err != nil {
+		t.Error("valid key rejected:", err)
+	}
+
+	for _, k := range []string{"", "BCA2BCA3", "41414141414141414141414141414141"} {
+		key, _ := hex.DecodeString(k)
+		if err := v.Validate(key, 1); !errors.Is(err, accounts.ErrInvalidKey) {
+			t.Error(k, "expected ErrInvalidKey, got", err)
+		}
+	}
+}
+
+func TestAllowlistValidator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cdkeys.txt")
+	os.WriteFile(path, []byte("# comment\n"+dumpKey[:32]+"\n"), 0o644)
+
+	v, err := accounts.NewAllowlistValidator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := hex.DecodeString(dumpKey)
+	if err := v.Validate(key, 1); err != nil {
+		t.Error("listed key rejected:", err)
+	}
+
+	key[0] = 0x42
+	if err := v.Validate(key, 1); !errors.Is(err, accounts.ErrInvalidKey) {
+		t.Error("expected ErrInvalidKey, got", err)
+	}
+}
+
+func TestReserveKey(t *testing.T) {
+	old := config.Cfg.MaxAccountsPerKey
+	config.Cfg.MaxAccountsPerKey = 2
+	t.Cleanup(func() { config.Cfg.MaxAccountsPerKey = old })
+
+	key := []byte(fmt.Sprint("claim-limit-key-", time.Now().UnixNano())) // bindings are global
+
+	// a released reservation, e.g. after a failed login, does not use up the key
+	c, err := accounts.ReserveKey(key, "failed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Release()
+	c.Release()
+
+	// reservations count towards the limit before they are bound
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var claimed []string
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("user%d", i)
+			c, err := accounts.ReserveKey(key, name)
+			if err != nil {
+				if !errors.Is(err, accounts.ErrKeyLimit) {
+					t.Error("unexpected error:", err)
+				}
+				return
+			}
+			defer c.Release()
+			time.Sleep(10 * time.Millisecond) // checking the password
+			c.Bind()
+
+			lock.Lock()
+			claimed = append(claimed, name)
+			lock.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	if len(claimed) != 2 {
+		t.Fatalf("%d accounts claimed the key, limit is 2", len(claimed))
+	}
+
+	// bound accounts can keep using the key
+	if _, err := accounts.ReserveKey(key, strings.ToUpper(claimed[0])); err != nil {
+		t.Error("bound account rejected:", err)
+	}
+	if _, err := accounts.ReserveKey(key, "other"); !errors.Is(err, accounts.ErrKeyLimit) {
+		t.Error("expected ErrKeyLimit, got", err)
+	}
+}
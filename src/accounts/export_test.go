@@ -0,0 +1,4 @@
+package accounts
+
+// PBKDF2 exposes the key derivation to the known-answer tests
+var PBKDF2 = pbkdf2
@@ -0,0 +1,135 @@
+package accounts
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"s2dnglobby/library"
+)
+
+// FileStore keeps all accounts in memory and writes them to a JSON file on change,
+// returned records are copies
+type FileStore struct {
+	path    string
+	records map[string]*Record
+	lock    sync.RWMutex
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path:    path,
+		records: make(map[string]*Record),
+	}
+
+	var list []*Record
+	if err := library.ReadJSON(path, &list); err != nil {
+		return nil, err
+	}
+	for _, r := range list {
+		s.records[library.NormalizeName(r.Name)] = r
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) Create(name, password string) (*Record, error) {
+	key := library.NormalizeName(name)
+
+	if _, ok := s.Get(name); ok {
+		return nil, ErrUserExists
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	// hashing is slow on purpose, so it happens outside of the lock
+	r := &Record{
+		Name:    name,
+		Salt:    hex.EncodeToString(salt),
+		Hash:    hex.EncodeToString(hashPassword(password, salt)),
+		Created: time.Now(),
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.records[key]; ok {
+		return nil, ErrUserExists
+	}
+	s.records[key] = r
+
+	if err := s.save(); err != nil {
+		delete(s.records, key)
+		return nil, err
+	}
+
+	log.Infoln("Created account", name)
+	c := *r
+	return &c, nil
+}
+
+func (s *FileStore) Authenticate(name, password string) (*Record, error) {
+	s.lock.RLock()
+	r, ok := s.records[library.NormalizeName(name)]
+	var saltHex, hashHex string
+	if ok {
+		saltHex, hashHex = r.Salt, r.Hash
+	}
+	s.lock.RUnlock()
+
+	if !ok {
+		return nil, ErrAuthFailed
+	}
+
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hex.DecodeString(hashHex)
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare(hash, hashPassword(password, salt)) != 1 {
+		return nil, ErrAuthFailed
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r.LastLogin = time.Now()
+	if err := s.save(); err != nil {
+		log.Errorln("Failed to store account file:", err)
+	}
+
+	c := *r
+	return &c, nil
+}
+
+func (s *FileStore) Get(name string) (*Record, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	r, ok := s.records[library.NormalizeName(name)]
+	if !ok {
+		return nil, false
+	}
+
+	c := *r
+	return &c, true
+}
+
+// save has to be called with the lock held
+func (s *FileStore) save() error {
+	list := make([]*Record, 0, len(s.records))
+	for _, r := range s.records {
+		list = append(list, r)
+	}
+
+	return library.WriteJSON(s.path, list)
+}
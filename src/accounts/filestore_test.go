@@ -0,0 +1,40 @@
+package accounts_test
+
+import (
+	"errors"
+	"path/filepath"
+	"s2dnglobby/accounts"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+
+	s, err := accounts.NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Create("Test", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create(" test ", "other"); !errors.Is(err, accounts.ErrUserExists) {
+		t.Error("expected ErrUserExists, got", err)
+	}
+
+	// reload from disk
+	s, err = accounts.NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Authenticate("test", "secret"); err != nil {
+		t.Error("valid credentials rejected:", err)
+	}
+	if _, err := s.Authenticate("test", "wrong"); !errors.Is(err, accounts.ErrAuthFailed) {
+		t.Error("expected ErrAuthFailed, got", err)
+	}
+	if _, err := s.Authenticate("unknown", "secret"); !errors.Is(err, accounts.ErrAuthFailed) {
+		t.Error("expected ErrAuthFailed, got", err)
+	}
+}
@@ -0,0 +1,135 @@
+package accounts
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"s2dnglobby/config"
+	"s2dnglobby/library"
+)
+
+/*
+* Friends lists of accounts, one-sided like a bookmark.
+* Stored by account name, so they work in open and file mode. Guests have none.
+ */
+
+const MaxFriends = 100
+
+var ErrUnknownAccount = errors.New("unknown account")
+var ErrFriendExists = errors.New("already on the friends list")
+var ErrTooManyFriends = errors.New("friends list is full")
+
+type friendLists struct {
+	path string
+	lock sync.Mutex
+
+	Lists map[string][]string // normalized account name -> friend names
+}
+
+var friends = &friendLists{Lists: make(map[string][]string)}
+
+func initFriends() error {
+	f := &friendLists{
+		path:  filepath.Join(config.DataDir, "friends.json"),
+		Lists: make(map[string][]string),
+	}
+	if err := library.ReadJSON(f.path, f); err != nil {
+		return fmt.Errorf("failed to load friends: %w", err)
+	}
+	if f.Lists == nil {
+		f.Lists = make(map[string][]string)
+	}
+	friends = f
+
+	return nil
+}
+
+// Exists checks if the name belongs to an account which logged in before
+func Exists(name string) bool {
+	uids.lock.Lock()
+	defer uids.lock.Unlock()
+
+	_, ok := uids.Ids[library.NormalizeName(name)]
+	return ok
+}
+
+func AddFriend(name, friend string) error {
+	if !Exists(friend) {
+		return ErrUnknownAccount
+	}
+
+	key := library.NormalizeName(name)
+
+	friends.lock.Lock()
+	defer friends.lock.Unlock()
+
+	list := friends.Lists[key]
+	if slices.ContainsFunc(list, sameName(friend)) {
+		return ErrFriendExists
+	}
+	if len(list) >= MaxFriends {
+		return ErrTooManyFriends
+	}
+
+	friends.Lists[key] = append(list, friend)
+	friends.save()
+	return nil
+}
+
+func RemoveFriend(name, friend string) bool {
+	key := library.NormalizeName(name)
+
+	friends.lock.Lock()
+	defer friends.lock.Unlock()
+
+	list := friends.Lists[key]
+	i := slices.IndexFunc(list, sameName(friend))
+	if i < 0 {
+		return false
+	}
+
+	list = slices.Delete(list, i, i+1)
+	if len(list) == 0 {
+		delete(friends.Lists, key)
+	} else {
+		friends.Lists[key] = list
+	}
+	friends.save()
+	return true
+}
+
+// Friends returns a copy of the friends list of the account
+func Friends(name string) []string {
+	friends.lock.Lock()
+	defer friends.lock.Unlock()
+
+	return slices.Clone(friends.Lists[library.NormalizeName(name)])
+}
+
+// IsFriend checks if other is on the friends list of name
+func IsFriend(name, other string) bool {
+	friends.lock.Lock()
+	defer friends.lock.Unlock()
+
+	return slices.ContainsFunc(friends.Lists[library.NormalizeName(name)], sameName(other))
+}
+
+func sameName(name string) func(string) bool {
+	key := library.NormalizeName(name)
+	return func(s string) bool {
+		return library.NormalizeName(s) == key
+	}
+}
+
+// save has to be called with the lock held
+func (f *friendLists) save() {
+	if f.path == "" {
+		return
+	}
+	if err := library.WriteJSON(f.path, f); err != nil {
+		log.Errorln("Failed to store friends:", err)
+	}
+}
@@ -0,0 +1,41 @@
+package accounts_test
+
+import (
+	"errors"
+	"testing"
+
+	"s2dnglobby/accounts"
+)
+
+func TestFriends(t *testing.T) {
+	// open mode, registering only assigns the uid
+	for _, name := range []string{"alice", "Bob"} {
+		if _, err := accounts.Register(name, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := accounts.AddFriend("alice", "nobody"); !errors.Is(err, accounts.ErrUnknownAccount) {
+		t.Error("expected ErrUnknownAccount, got", err)
+	}
+	if err := accounts.AddFriend("alice", "Bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := accounts.AddFriend("Alice", "bob"); !errors.Is(err, accounts.ErrFriendExists) {
+		t.Error("expected ErrFriendExists, got", err)
+	}
+
+	if !accounts.IsFriend("alice", " BOB ") || accounts.IsFriend("bob", "alice") {
+		t.Error("friendship should be one-sided")
+	}
+	if list := accounts.Friends("alice"); len(list) != 1 || list[0] != "Bob" {
+		t.Error("unexpected friends list:", list)
+	}
+
+	if !accounts.RemoveFriend("alice", "bob") || accounts.RemoveFriend("alice", "bob") {
+		t.Error("friend should be removed exactly once")
+	}
+	if accounts.IsFriend("alice", "bob") {
+		t.Error("removed friend still on the list")
+	}
+}
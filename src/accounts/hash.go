@@ -0,0 +1,48 @@
+package accounts
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+const saltSize = 16
+const hashIterations = 100_000
+
+// hashPassword derives the password hash with PBKDF2-HMAC-SHA256
+func hashPassword(password string, salt []byte) []byte {
+	return pbkdf2([]byte(password), salt, hashIterations, sha256.Size)
+}
+
+// pbkdf2 implements PBKDF2 with HMAC-SHA256 as the PRF (RFC 8018)
+func pbkdf2(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+
+	var result []byte
+	var block [4]byte
+
+	for i := uint32(1); len(result) < keyLen; i++ {
+		binary.BigEndian.PutUint32(block[:], i)
+
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(block[:])
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		result = append(result, t...)
+	}
+
+	return result[:keyLen]
+}
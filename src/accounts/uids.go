@@ -0,0 +1,81 @@
+package accounts
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"s2dnglobby/library"
+)
+
+/*
+* User IDs:
+* 0: system messages
+* 1 - 0x7FFFFFFF: accounts / nicknames, persisted
+* 0x80000000 - 0xFFFFFFFF: guest sessions, not persisted
+ */
+
+const firstGuestUid = 0x8000_0000
+
+type uidRegistry struct {
+	path string
+	lock sync.Mutex
+
+	Last uint32
+	Ids  map[string]uint32
+}
+
+var uids = &uidRegistry{Ids: make(map[string]uint32)}
+var guestCounter atomic.Uint32
+
+func loadUidRegistry(path string) (*uidRegistry, error) {
+	r := &uidRegistry{
+		path: path,
+		Ids:  make(map[string]uint32),
+	}
+
+	if err := library.ReadJSON(path, r); err != nil {
+		return nil, fmt.Errorf("failed to load user IDs: %w", err)
+	}
+	if r.Ids == nil {
+		r.Ids = make(map[string]uint32)
+	}
+
+	return r, nil
+}
+
+// uidFor returns the ID bound to the name, a new one gets assigned on first use
+func (r *uidRegistry) uidFor(name string) uint32 {
+	key := library.NormalizeName(name)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if id, ok := r.Ids[key]; ok {
+		return id
+	}
+
+	if r.Last+1 >= firstGuestUid {
+		log.Errorln("Ran out of user IDs, treating", name, "as guest")
+		return NextGuestUid()
+	}
+
+	r.Last++
+	r.Ids[key] = r.Last
+
+	if r.path != "" {
+		if err := library.WriteJSON(r.path, r); err != nil {
+			log.Errorln("Failed to store user IDs:", err)
+		}
+	}
+
+	return r.Last
+}
+
+func NextGuestUid() uint32 {
+	return firstGuestUid + guestCounter.Add(1) - 1
+}
+
+func IsGuestUid(uid uint32) bool {
+	return uid >= firstGuestUid
+}
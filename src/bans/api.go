@@ -0,0 +1,105 @@
+package bans
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"s2dnglobby/library"
+)
+
+type banRequest struct {
+	Kind     Kind
+	Value    string // account name, IP / CIDR or CD key (hex)
+	User     string // alternatively take the value from a logged in user
+	Reason   string
+	Duration string // e.g. "2h" or "7d", empty means permanent
+}
+
+func initAPI() {
+	// GET: list active bans, POST: add ban, DELETE ?id=<id>: remove ban
+	http.HandleFunc("/api/admin/bans", library.AdminOnly(handleBans))
+}
+
+func handleBans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		library.WriteJSONResponse(w, List())
+
+	case http.MethodPost:
+		req := new(banRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		b, err := FromRequest(req.Kind, req.Value, req.User, req.Duration)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b.Reason = req.Reason
+		b.CreatedBy = "admin API"
+
+		b, err = Add(b)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		library.WriteJSONResponse(w, b)
+
+	case http.MethodDelete:
+		id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+		if err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		if !Remove(uint32(id)) {
+			http.Error(w, "ban not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// FromRequest creates a ban, the value can be taken from a logged in user
+func FromRequest(kind Kind, value, user, duration string) (Ban, error) {
+	b := Ban{Kind: kind, Value: value}
+
+	if user != "" {
+		if lob == nil {
+			return b, fmt.Errorf("user %s is not online", user)
+		}
+		u, ok := lob.GetUserByName(user)
+		if !ok {
+			return b, fmt.Errorf("user %s is not online", user)
+		}
+
+		switch kind {
+		case KindAccount:
+			b.Value = u.Name
+		case KindIP:
+			b.Value = library.RemoteIP(u.Connection)
+		case KindKey:
+			if u.KeyHash == "" {
+				return b, fmt.Errorf("CD key of %s is unknown", user)
+			}
+			b.Value = u.KeyHash
+		}
+	}
+
+	if duration != "" {
+		d, err := ParseDuration(duration)
+		if err != nil {
+			return b, err
+		}
+		b.Expires = time.Now().Add(d)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,254 @@
+package bans
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"s2dnglobby/accounts"
+	"s2dnglobby/config"
+	"s2dnglobby/library"
+	"s2dnglobby/lobby"
+)
+
+var log = library.GetLogger("Bans")
+
+type Kind string
+
+const (
+	KindAccount Kind = "account"
+	KindIP      Kind = "ip"    // single IP or CIDR range
+	KindKey     Kind = "cdkey" // hash of the CD key, see accounts.HashKey
+)
+
+type Ban struct {
+	Id        uint32
+	Kind      Kind
+	Value     string
+	Reason    string
+	CreatedBy string
+	Created   time.Time
+	Expires   time.Time // zero means permanent
+}
+
+func (b *Ban) Expired(now time.Time) bool {
+	return !b.Expires.IsZero() && now.After(b.Expires)
+}
+
+// Message is shown to the banned user
+func (b *Ban) Message() string {
+	msg := "You are banned"
+	if b.Reason != "" {
+		msg += ": " + b.Reason
+	}
+	if !b.Expires.IsZero() {
+		msg += fmt.Sprintf(" (until %s)", b.Expires.UTC().Format("2006-01-02 15:04 MST"))
+	}
+	return msg
+}
+
+// Matches checks if the ban applies to the given values
+func (b *Ban) Matches(name, ip, keyHash string) bool {
+	switch b.Kind {
+	case KindAccount:
+		return name != "" && library.NormalizeName(name) == b.Value
+	case KindKey:
+		return keyHash != "" && keyHash == b.Value
+	case KindIP:
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			return false
+		}
+		if _, network, err := net.ParseCIDR(b.Value); err == nil {
+			return network.Contains(addr)
+		}
+		return addr.Equal(net.ParseIP(b.Value))
+	}
+	return false
+}
+
+type banList struct {
+	LastId uint32
+	Bans   []*Ban
+}
+
+var path string
+var list = &banList{}
+var lob *lobby.Lobby // to take ban values from logged in users
+var listLock sync.Mutex
+
+// OnAdd gets called for every new ban, used to kick affected users
+var OnAdd func(b Ban)
+
+func InitBans(users *lobby.Lobby) error {
+	path = filepath.Join(config.DataDir, "bans.json")
+	lob = users
+
+	l := &banList{}
+	if err := library.ReadJSON(path, l); err != nil {
+		return fmt.Errorf("failed to load bans: %w", err)
+	}
+	list = l
+
+	initAPI()
+
+	log.Infoln("Bans initialized with", len(list.Bans), "entries")
+	return nil
+}
+
+// normalizeValue brings the value into the form it is stored in
+func normalizeValue(kind Kind, value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	switch kind {
+	case KindAccount:
+		v := library.NormalizeName(value)
+		if v == "" {
+			return "", fmt.Errorf("empty account name")
+		}
+		return v, nil
+
+	case KindIP:
+		if _, network, err := net.ParseCIDR(value); err == nil {
+			return network.String(), nil
+		}
+		if ip := net.ParseIP(value); ip != nil {
+			return ip.String(), nil
+		}
+		return "", fmt.Errorf("invalid IP or CIDR: %s", value)
+
+	case KindKey:
+		value = strings.ToLower(value)
+		raw, err := hex.DecodeString(value)
+		if err != nil {
+			return "", fmt.Errorf("CD key has to be hex encoded")
+		}
+		if len(raw) == 32 { // already hashed
+			return value, nil
+		}
+		return accounts.HashKey(raw), nil
+	}
+
+	return "", fmt.Errorf("unknown ban kind: %s", kind)
+}
+
+func Add(b Ban) (Ban, error) {
+	value, err := normalizeValue(b.Kind, b.Value)
+	if err != nil {
+		return b, err
+	}
+	b.Value = value
+	b.Created = time.Now()
+
+	listLock.Lock()
+	list.LastId++
+	b.Id = list.LastId
+	c := b
+	list.Bans = append(list.Bans, &c)
+	err = save()
+	listLock.Unlock()
+
+	if err != nil {
+		log.Errorln("Failed to store bans:", err)
+	}
+
+	log.Infoln("Added ban", b.Id, b.Kind, b.Value, "by", b.CreatedBy+":", b.Reason)
+
+	if OnAdd != nil {
+		OnAdd(b)
+	}
+	return b, nil
+}
+
+func Remove(id uint32) bool {
+	listLock.Lock()
+	defer listLock.Unlock()
+
+	for i, b := range list.Bans {
+		if b.Id == id {
+			list.Bans = append(list.Bans[:i], list.Bans[i+1:]...)
+			if err := save(); err != nil {
+				log.Errorln("Failed to store bans:", err)
+			}
+			log.Infoln("Removed ban", id)
+			return true
+		}
+	}
+	return false
+}
+
+// List returns all active bans
+func List() []Ban {
+	listLock.Lock()
+	defer listLock.Unlock()
+
+	pruneExpired()
+
+	res := make([]Ban, 0, len(list.Bans))
+	for _, b := range list.Bans {
+		res = append(res, *b)
+	}
+	return res
+}
+
+// Check returns the first active ban matching any of the given values,
+// empty values are ignored
+func Check(name, ip, keyHash string) (Ban, bool) {
+	listLock.Lock()
+	defer listLock.Unlock()
+
+	now := time.Now()
+	for _, b := range list.Bans {
+		if !b.Expired(now) && b.Matches(name, ip, keyHash) {
+			return *b, true
+		}
+	}
+	return Ban{}, false
+}
+
+// pruneExpired has to be called with the lock held
+func pruneExpired() {
+	now := time.Now()
+	active := list.Bans[:0]
+
+	for _, b := range list.Bans {
+		if !b.Expired(now) {
+			active = append(active, b)
+		}
+	}
+	if len(active) == len(list.Bans) {
+		return
+	}
+
+	list.Bans = active
+	if err := save(); err != nil {
+		log.Errorln("Failed to store bans:", err)
+	}
+}
+
+// save has to be called with the lock held
+func save() error {
+	if path == "" {
+		return nil
+	}
+	return library.WriteJSON(path, list)
+}
+
+// ParseDuration extends time.ParseDuration with days (d) and weeks (w)
+func ParseDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration: %s", s)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,45 @@
+package bans_test
+
+import (
+	"s2dnglobby/bans"
+	"testing"
+	"time"
+)
+
+func TestBanMatches(t *testing.T) {
+	tests := []struct {
+		ban   bans.Ban
+		name  string
+		ip    string
+		match bool
+	}{
+		{bans.Ban{Kind: bans.KindAccount, Value: "troll"}, " Troll ", "", true},
+		{bans.Ban{Kind: bans.KindAccount, Value: "troll"}, "trolly", "", false},
+		{bans.Ban{Kind: bans.KindIP, Value: "10.0.0.0/8"}, "", "10.1.2.3", true},
+		{bans.Ban{Kind: bans.KindIP, Value: "10.0.0.0/8"}, "", "192.168.0.1", false},
+		{bans.Ban{Kind: bans.KindIP, Value: "1.2.3.4"}, "", "1.2.3.4", true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.ban.Matches(tt.name, tt.ip, ""); got != tt.match {
+			t.Error(tt.ban, tt.name, tt.ip, "expected", tt.match, "got", got)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"30m": 30 * time.Minute,
+		"2d":  48 * time.Hour,
+		"1w":  7 * 24 * time.Hour,
+	}
+
+	for in, want := range tests {
+		if got, err := bans.ParseDuration(in); err != nil || got != want {
+			t.Error(in, "expected", want, "got", got, err)
+		}
+	}
+	if _, err := bans.ParseDuration("forever"); err == nil {
+		t.Error("expected error for invalid duration")
+	}
+}
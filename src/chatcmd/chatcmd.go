@@ -0,0 +1,199 @@
+package chatcmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"s2dnglobby/lobby"
+)
+
+/*
+* Chat messages starting with "/" are commands.
+* Replies only go to the caller, "//" escapes a leading slash.
+ */
+
+const Prefix = "/"
+
+type Role int
+
+const (
+	RoleUser Role = iota
+	RoleModerator
+)
+
+func RoleOf(user *lobby.Account) Role {
+	if user.Moderator {
+		return RoleModerator
+	}
+	return RoleUser
+}
+
+type Context struct {
+	User *lobby.Account
+	Args []string
+	Raw  string // everything after the command name, unparsed
+
+	Reply func(txt string)
+}
+
+func (c *Context) Replyf(format string, v ...any) {
+	c.Reply(fmt.Sprintf(format, v...))
+}
+
+type Command struct {
+	Name    string
+	Aliases []string
+	Usage   string // arguments, e.g. "<user> [reason]"
+	Help    string
+	Role    Role // minimum role needed
+	MinArgs int
+	RawArgs bool // free text argument, Args are split at whitespace only
+
+	Run func(ctx *Context)
+}
+
+type Registry struct {
+	commands map[string]*Command
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		commands: make(map[string]*Command),
+	}
+}
+
+func (r *Registry) Register(cmd *Command) {
+	for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+		if _, ok := r.commands[name]; ok {
+			panic("chat command registered twice: " + name)
+		}
+		r.commands[name] = cmd
+	}
+}
+
+func (r *Registry) Get(name string) (*Command, bool) {
+	cmd, ok := r.commands[strings.ToLower(strings.TrimPrefix(name, Prefix))]
+	return cmd, ok
+}
+
+// Available returns the commands the role may use, sorted by name
+func (r *Registry) Available(role Role) []*Command {
+	var list []*Command
+	for name, cmd := range r.commands {
+		if name == cmd.Name && cmd.Role <= role {
+			list = append(list, cmd)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// IsCommand checks if the message has to be handled by Dispatch
+func IsCommand(txt string) bool {
+	return strings.HasPrefix(txt, Prefix) && !strings.HasPrefix(txt, Prefix+Prefix)
+}
+
+// Unescape removes the escaping of a leading slash in normal chat messages
+func Unescape(txt string) string {
+	if strings.HasPrefix(txt, Prefix+Prefix) {
+		return txt[len(Prefix):]
+	}
+	return txt
+}
+
+// Name returns the command name of a message, without arguments (they may contain passwords)
+func Name(txt string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(txt, Prefix), " ")
+	return name
+}
+
+// Dispatch runs the command in txt, errors get replied to the caller
+func (r *Registry) Dispatch(user *lobby.Account, txt string, reply func(string)) {
+	name, raw, _ := strings.Cut(strings.TrimPrefix(txt, Prefix), " ")
+	raw = strings.TrimSpace(raw)
+
+	cmd, ok := r.Get(name)
+	if !ok || cmd.Role > RoleOf(user) {
+		reply(fmt.Sprintf("Unknown command %s%s, try %shelp", Prefix, name, Prefix))
+		return
+	}
+
+	args := strings.Fields(raw)
+	if !cmd.RawArgs {
+		var err error
+		if args, err = ParseArgs(raw); err != nil {
+			reply(err.Error())
+			return
+		}
+	}
+	if len(args) < cmd.MinArgs {
+		reply(cmd.UsageLine())
+		return
+	}
+
+	cmd.Run(&Context{
+		User:  user,
+		Args:  args,
+		Raw:   raw,
+		Reply: reply,
+	})
+}
+
+func (c *Command) UsageLine() string {
+	line := "usage: " + Prefix + c.Name
+	if c.Usage != "" {
+		line += " " + c.Usage
+	}
+	return line
+}
+
+// ParseArgs splits at whitespace, double quotes group words
+func ParseArgs(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inQuotes := false
+	hasArg := false
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case !inQuotes && (r == ' ' || r == '\t'):
+			if hasArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				hasArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			hasArg = true
+		}
+	}
+
+	if inQuotes {
+		return nil, fmt.Errorf("missing closing quote")
+	}
+	if hasArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// CutArg splits off the first argument, which may be quoted,
+// and returns the rest of the text untouched
+func CutArg(raw string) (string, string) {
+	raw = strings.TrimLeft(raw, " \t")
+
+	if strings.HasPrefix(raw, `"`) {
+		if arg, rest, ok := strings.Cut(raw[1:], `"`); ok {
+			return arg, strings.TrimSpace(rest)
+		}
+	}
+
+	arg, rest, _ := strings.Cut(raw, " ")
+	return arg, strings.TrimSpace(rest)
+}
@@ -0,0 +1,98 @@
+package chatcmd_test
+
+import (
+	"reflect"
+	"s2dnglobby/chatcmd"
+	"s2dnglobby/lobby"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := map[string][]string{
+		"":                      nil,
+		"a b  c":                {"a", "b", "c"},
+		`ban "Some Name" 2h`:    {"ban", "Some Name", "2h"},
+		`say ""`:                {"say", ""},
+		`x "quoted"suffix rest`: {"x", "quotedsuffix", "rest"},
+	}
+
+	for in, want := range tests {
+		got, err := chatcmd.ParseArgs(in)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected %q, got %q %v", in, want, got, err)
+		}
+	}
+
+	if _, err := chatcmd.ParseArgs(`"open`); err == nil {
+		t.Error("expected error for missing quote")
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	r := chatcmd.NewRegistry()
+
+	var ran []string
+	r.Register(&chatcmd.Command{
+		Name:    "echo",
+		Aliases: []string{"e"},
+		MinArgs: 1,
+		Run: func(ctx *chatcmd.Context) {
+			ran = append(ran, ctx.Raw)
+		},
+	})
+	r.Register(&chatcmd.Command{
+		Name: "kick",
+		Role: chatcmd.RoleModerator,
+		Run: func(ctx *chatcmd.Context) {
+			ran = append(ran, "kick")
+		},
+	})
+
+	var replies []string
+	reply := func(txt string) { replies = append(replies, txt) }
+
+	user := &lobby.Account{Name: "user"}
+	mod := &lobby.Account{Name: "mod", Moderator: true}
+
+	r.Dispatch(user, "/E hello world", reply)
+	r.Dispatch(user, "/echo", reply)
+	r.Dispatch(user, "/kick", reply)
+	r.Dispatch(mod, "/kick", reply)
+
+	if !reflect.DeepEqual(ran, []string{"hello world", "kick"}) {
+		t.Error("unexpected commands ran:", ran)
+	}
+	if len(replies) != 2 || !strings.HasPrefix(replies[0], "usage:") || !strings.HasPrefix(replies[1], "Unknown command") {
+		t.Error("unexpected replies:", replies)
+	}
+}
+
+func TestCutArg(t *testing.T) {
+	tests := [][3]string{
+		{"bob hi there", "bob", "hi there"},
+		{`"Some Name" he said "hi`, "Some Name", `he said "hi`},
+		{"bob", "bob", ""},
+	}
+
+	for _, tt := range tests {
+		arg, rest := chatcmd.CutArg(tt[0])
+		if arg != tt[1] || rest != tt[2] {
+			t.Errorf("%q: expected %q %q, got %q %q", tt[0], tt[1], tt[2], arg, rest)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	tests := map[string]string{
+		"/joinpass 12 secret": "joinpass",
+		"/who":                "who",
+		"/w bob hi":           "w",
+	}
+
+	for in, want := range tests {
+		if got := chatcmd.Name(in); got != want {
+			t.Errorf("%q: expected %q, got %q", in, want, got)
+		}
+	}
+}
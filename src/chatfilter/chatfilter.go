@@ -0,0 +1,282 @@
+package chatfilter
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"s2dnglobby/library"
+)
+
+var log = library.GetLogger("ChatFilter")
+
+const reloadInterval = 5 * time.Second
+
+type Verdict struct {
+	Action Action
+	Text   string // possibly censored text
+	Reason string // shown to the sender if the message got dropped
+}
+
+type userState struct {
+	recent     []sentMessage
+	violations []time.Time
+	mutedUntil time.Time
+}
+
+type sentMessage struct {
+	txt  string
+	time time.Time
+}
+
+type Filter struct {
+	rules *Rules
+	users map[string]*userState // by sender, see Check
+	lock  sync.Mutex
+}
+
+func New(rules *Rules) *Filter {
+	if rules == nil {
+		rules = new(Rules)
+	}
+	return &Filter{
+		rules: rules,
+		users: make(map[string]*userState),
+	}
+}
+
+func (f *Filter) SetRules(rules *Rules) {
+	f.lock.Lock()
+	f.rules = rules
+	f.lock.Unlock()
+}
+
+// Check runs the message through all stages, the sender identifies whose flood,
+// repeat and mute state applies and has to outlive reconnects
+func (f *Filter) Check(sender string, txt string, now time.Time) Verdict {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	r := f.rules
+	state, ok := f.users[sender]
+	if !ok {
+		state = new(userState)
+		f.users[sender] = state
+	}
+
+	if now.Before(state.mutedUntil) {
+		return Verdict{
+			Action: ActionDrop,
+			Reason: "You are muted for " + state.mutedUntil.Sub(now).Round(time.Second).String(),
+		}
+	}
+
+	v := Verdict{Text: txt}
+	apply := func(action Action, reason string, censor func(string) string) {
+		if action == ActionCensor && censor != nil {
+			v.Text = censor(v.Text)
+		}
+		if action.severity() > v.Action.severity() {
+			v.Action = action
+			v.Reason = reason
+		}
+	}
+
+	if r.MaxLength > 0 && len([]rune(txt)) > r.MaxLength {
+		apply(r.LengthAction, "Message too long", func(s string) string {
+			return string([]rune(s)[:r.MaxLength])
+		})
+	}
+
+	if r.FloodMessages > 0 && r.FloodWindow > 0 {
+		count := 0
+		for _, m := range state.recent {
+			if now.Sub(m.time) < time.Duration(r.FloodWindow) {
+				count++
+			}
+		}
+		if count >= r.FloodMessages {
+			apply(r.FloodAction, "You are sending messages too fast", nil)
+		}
+	}
+
+	if r.MaxRepeats > 0 && r.RepeatWindow > 0 {
+		count := 0
+		for _, m := range state.recent {
+			if now.Sub(m.time) < time.Duration(r.RepeatWindow) && strings.EqualFold(m.txt, txt) {
+				count++
+			}
+		}
+		if count >= r.MaxRepeats {
+			apply(ActionDrop, "Please do not repeat yourself", nil)
+		}
+	}
+
+	if r.BlockLinks {
+		censor := func(s string) string {
+			return linkRegex.ReplaceAllStringFunc(s, func(link string) string {
+				if r.linkAllowed(link) {
+					return link
+				}
+				return "[link removed]"
+			})
+		}
+		for _, link := range linkRegex.FindAllString(v.Text, -1) {
+			if !r.linkAllowed(link) {
+				apply(r.LinkAction, "Links are not allowed", censor)
+				break
+			}
+		}
+	}
+
+	if r.words != nil && r.words.MatchString(v.Text) {
+		apply(r.WordAction, "Watch your language", func(s string) string {
+			return r.words.ReplaceAllStringFunc(s, stars)
+		})
+	}
+
+	for _, p := range r.Patterns {
+		if !p.re.MatchString(v.Text) {
+			continue
+		}
+		apply(p.Action, "Message not allowed", func(s string) string {
+			if p.Replace != "" {
+				return p.re.ReplaceAllString(s, p.Replace)
+			}
+			return p.re.ReplaceAllStringFunc(s, stars)
+		})
+	}
+
+	if r.CapsRatio > 0 && isShouting(v.Text, r.CapsRatio, r.CapsMinLength) {
+		apply(r.CapsAction, "Please do not shout", strings.ToLower)
+	}
+
+	state.recent = append(state.recent, sentMessage{txt: txt, time: now})
+	state.recent = pruneMessages(state.recent, now, r.window())
+
+	if v.Action == ActionDrop || v.Action == ActionMute {
+		state.violations = append(state.violations, now)
+		state.violations = pruneTimes(state.violations, now, time.Duration(r.ViolationWindow))
+
+		if r.MuteAfterViolations > 0 && len(state.violations) >= r.MuteAfterViolations {
+			v.Action = ActionMute
+		}
+	}
+
+	if v.Action == ActionMute && r.MuteDuration > 0 {
+		state.mutedUntil = now.Add(time.Duration(r.MuteDuration))
+		state.violations = nil
+		v.Reason += ", you are muted for " + time.Duration(r.MuteDuration).String()
+	}
+
+	return v
+}
+
+// Forget drops the state of a sender unless it is muted, e.g. on logout
+func (f *Filter) Forget(sender string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if s, ok := f.users[sender]; ok && time.Now().After(s.mutedUntil) {
+		delete(f.users, sender)
+	}
+}
+
+func (r *Rules) linkAllowed(link string) bool {
+	for _, a := range r.AllowedLinks {
+		if strings.Contains(strings.ToLower(link), strings.ToLower(a)) {
+			return true
+		}
+	}
+	return false
+}
+
+// window is the time messages have to be kept for the flood and repeat checks
+func (r *Rules) window() time.Duration {
+	return max(time.Duration(r.FloodWindow), time.Duration(r.RepeatWindow))
+}
+
+func isShouting(txt string, ratio float64, minLength int) bool {
+	letters, upper := 0, 0
+	for _, c := range txt {
+		if unicode.IsLetter(c) {
+			letters++
+			if unicode.IsUpper(c) {
+				upper++
+			}
+		}
+	}
+	return letters >= max(minLength, 1) && float64(upper)/float64(letters) >= ratio
+}
+
+func stars(s string) string {
+	return strings.Repeat("*", len([]rune(s)))
+}
+
+func pruneMessages(list []sentMessage, now time.Time, window time.Duration) []sentMessage {
+	for len(list) > 0 && now.Sub(list[0].time) >= window {
+		list = list[1:]
+	}
+	return list
+}
+
+func pruneTimes(list []time.Time, now time.Time, window time.Duration) []time.Time {
+	if window <= 0 {
+		return list
+	}
+	for len(list) > 0 && now.Sub(list[0]) >= window {
+		list = list[1:]
+	}
+	return list
+}
+
+/* default filter, reloaded from the rules file */
+
+var filter = New(nil)
+
+func InitChatFilter(path string) {
+	var lastMod time.Time
+
+	load := func() {
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		if !info.ModTime().After(lastMod) {
+			return
+		}
+		lastMod = info.ModTime()
+
+		rules, err := LoadRules(path)
+		if err != nil {
+			log.Errorln("Failed to load rules, keeping the old ones:", err)
+			return
+		}
+		filter.SetRules(rules)
+		log.Infoln("Loaded chat filter rules from", path)
+	}
+
+	load()
+
+	go func() {
+		for {
+			time.Sleep(reloadInterval)
+			load()
+		}
+	}()
+}
+
+func Check(sender string, txt string) Verdict {
+	return filter.Check(sender, txt, time.Now())
+}
+
+func Forget(sender string) {
+	filter.Forget(sender)
+}
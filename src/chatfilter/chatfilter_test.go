@@ -0,0 +1,101 @@
+package chatfilter_test
+
+import (
+	"s2dnglobby/chatfilter"
+	"testing"
+	"time"
+)
+
+func newFilter(t *testing.T, r *chatfilter.Rules) *chatfilter.Filter {
+	if err := r.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	return chatfilter.New(r)
+}
+
+func TestWordsAndLinks(t *testing.T) {
+	f := newFilter(t, &chatfilter.Rules{
+		Words:        []string{"darn", "", "  "}, // empty words must not match everything
+		BlockLinks:   true,
+		AllowedLinks: []string{"discord.gg/UAXH3VS9Qy"},
+	})
+	now := time.Now()
+
+	tests := map[string]string{
+		"oh darn it":                       "oh **** it",
+		"darning socks":                    "darning socks",
+		"join https://evil.example.com/x":  "join [link removed]",
+		"see discord.gg/UAXH3VS9Qy for it": "see discord.gg/UAXH3VS9Qy for it",
+	}
+
+	for in, want := range tests {
+		if v := f.Check("alice", in, now); v.Text != want {
+			t.Errorf("%q: expected %q, got %q", in, want, v.Text)
+		}
+		now = now.Add(time.Minute)
+	}
+}
+
+func TestRepeatAndMute(t *testing.T) {
+	f := newFilter(t, &chatfilter.Rules{
+		MaxRepeats:          1,
+		RepeatWindow:        chatfilter.Duration(time.Minute),
+		MuteAfterViolations: 2,
+		ViolationWindow:     chatfilter.Duration(time.Hour),
+		MuteDuration:        chatfilter.Duration(10 * time.Minute),
+	})
+	now := time.Now()
+
+	expected := []chatfilter.Action{
+		chatfilter.ActionNone,
+		chatfilter.ActionDrop,
+		chatfilter.ActionMute,
+	}
+	for i, want := range expected {
+		if v := f.Check("alice", "buy gold", now); v.Action != want {
+			t.Error("message", i, "expected", want, "got", v.Action)
+		}
+		now = now.Add(time.Second)
+	}
+
+	// a muted sender keeps the mute when logging out and in again
+	f.Forget("alice")
+	if v := f.Check("alice", "something else", now.Add(5*time.Minute)); v.Action != chatfilter.ActionDrop {
+		t.Error("muted user was not dropped:", v)
+	}
+	if v := f.Check("alice", "something else", now.Add(11*time.Minute)); v.Action != chatfilter.ActionNone {
+		t.Error("mute did not expire:", v)
+	}
+	if v := f.Check("bob", "buy gold", now); v.Action != chatfilter.ActionNone {
+		t.Error("other user affected:", v)
+	}
+}
+
+func TestCapsAndLength(t *testing.T) {
+	f := newFilter(t, &chatfilter.Rules{
+		MaxLength:     10,
+		CapsRatio:     0.8,
+		CapsMinLength: 5,
+	})
+
+	if v := f.Check("alice", "HELLO ALL", time.Now()); v.Text != "hello all" {
+		t.Error("caps not censored:", v.Text)
+	}
+	if v := f.Check("alice", "OK", time.Now()); v.Text != "OK" {
+		t.Error("short message censored:", v.Text)
+	}
+	if v := f.Check("alice", "hello everyone", time.Now()); v.Text != "hello ever" {
+		t.Error("message not truncated:", v.Text)
+	}
+}
+
+func TestEmptyWords(t *testing.T) {
+	f := newFilter(t, &chatfilter.Rules{
+		Words:      []string{" ", ""},
+		WordAction: chatfilter.ActionDrop,
+	})
+
+	if v := f.Check("alice", "hello there", time.Now()); v.Action == chatfilter.ActionDrop {
+		t.Error("empty words dropped a clean message:", v.Reason)
+	}
+}
@@ -0,0 +1,171 @@
+package chatfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Action string
+
+const defaultMuteDuration = 5 * time.Minute
+
+const (
+	ActionNone   Action = ""
+	ActionCensor Action = "censor" // replace the offending part
+	ActionDrop   Action = "drop"   // do not send the message
+	ActionMute   Action = "mute"   // drop the message and mute the sender
+)
+
+func (a Action) valid() bool {
+	switch a {
+	case ActionNone, ActionCensor, ActionDrop, ActionMute:
+		return true
+	}
+	return false
+}
+
+// severity decides which action wins if several stages trigger
+func (a Action) severity() int {
+	switch a {
+	case ActionCensor:
+		return 1
+	case ActionDrop:
+		return 2
+	case ActionMute:
+		return 3
+	}
+	return 0
+}
+
+type Pattern struct {
+	Regex   string
+	Action  Action
+	Replace string // used for censor, defaults to asterisks
+
+	re *regexp.Regexp
+}
+
+// Duration accepts "30s" style strings in JSON
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Rules are loaded from the filter file, zero values disable a stage,
+// actions default to censor (drop for flood and patterns)
+type Rules struct {
+	Words      []string // matched case insensitive as whole words
+	WordAction Action
+	Patterns   []*Pattern
+
+	MaxLength    int
+	LengthAction Action // censor truncates the message
+
+	MaxRepeats   int // identical messages allowed within RepeatWindow
+	RepeatWindow Duration
+
+	CapsRatio     float64 // share of upper case letters
+	CapsMinLength int     // shorter messages are ignored
+	CapsAction    Action  // censor converts to lower case
+
+	FloodMessages int // messages allowed within FloodWindow
+	FloodWindow   Duration
+	FloodAction   Action
+
+	BlockLinks   bool
+	AllowedLinks []string // substrings of links which are allowed
+	LinkAction   Action
+
+	MuteDuration        Duration
+	MuteAfterViolations int // drops within ViolationWindow until the user gets muted
+	ViolationWindow     Duration
+
+	words *regexp.Regexp
+}
+
+var linkRegex = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+|\b[a-z0-9-]+\.(?:com|net|org|gg|de|io|ru|xyz|me|ly)(?:/\S*)?\b`)
+
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(Rules)
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return r, r.Compile()
+}
+
+// Compile applies defaults and compiles the patterns, has to be called before use
+func (r *Rules) Compile() error {
+	defaults := []struct {
+		action *Action
+		dfl    Action
+	}{
+		{&r.WordAction, ActionCensor},
+		{&r.LengthAction, ActionCensor},
+		{&r.CapsAction, ActionCensor},
+		{&r.FloodAction, ActionDrop},
+		{&r.LinkAction, ActionCensor},
+	}
+	for _, d := range defaults {
+		if *d.action == ActionNone {
+			*d.action = d.dfl
+		}
+		if !d.action.valid() {
+			return fmt.Errorf("unknown action: %s", *d.action)
+		}
+	}
+
+	if r.MuteDuration <= 0 {
+		r.MuteDuration = Duration(defaultMuteDuration)
+	}
+
+	// empty words would match at every word boundary
+	var quoted []string
+	for _, w := range r.Words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) > 0 {
+		r.words = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	}
+
+	for _, p := range r.Patterns {
+		if p.Action == ActionNone {
+			p.Action = ActionDrop
+		}
+		if !p.Action.valid() {
+			return fmt.Errorf("unknown action: %s", p.Action)
+		}
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %s: %w", p.Regex, err)
+		}
+		p.re = re
+	}
+
+	return nil
+}
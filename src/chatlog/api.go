@@ -0,0 +1,53 @@
+package chatlog
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"s2dnglobby/library"
+)
+
+const defaultSearchLimit = 200
+
+func initAPI() {
+	// search the chat log: ?user=<name>&from=<RFC3339>&to=<RFC3339>&text=<substring>&limit=<n>
+	http.HandleFunc("/api/admin/chatlog", library.AdminOnly(handleSearch))
+}
+
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	q := Query{
+		User:  params.Get("user"),
+		Text:  params.Get("text"),
+		Limit: defaultSearchLimit,
+	}
+
+	var err error
+	if v := params.Get("from"); v != "" {
+		if q.From, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "invalid from, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := params.Get("to"); v != "" {
+		if q.To, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "invalid to, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := Search(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	library.WriteJSONResponse(w, entries)
+}
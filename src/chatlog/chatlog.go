@@ -0,0 +1,301 @@
+package chatlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"s2dnglobby/config"
+	"s2dnglobby/library"
+)
+
+var log = library.GetLogger("ChatLog")
+
+/*
+* Append-only log of all chat lines, one JSON object per line.
+* A new file gets started every day and whenever the file exceeds ChatLogMaxSize:
+* chat-2023-01-02.jsonl, chat-2023-01-02.1.jsonl, ...
+ */
+
+const (
+	ModeGlobal  = "global"
+	ModeWhisper = "whisper"
+	ModeRelay   = "relay" // global chat from outside the lobby, e.g. IRC
+)
+
+const dayFormat = "2006-01-02"
+const pruneInterval = time.Hour
+
+type Entry struct {
+	Time     time.Time
+	FromId   uint32
+	FromName string
+	Mode     string
+	To       string `json:",omitempty"` // recipient of whispers
+	Txt      string
+}
+
+var dir string
+var file *os.File
+var fileDay string
+var fileSize int64
+var fileLock sync.Mutex
+
+func InitChatLog() {
+	if err := Open(filepath.Join(config.DataDir, "chatlog")); err != nil {
+		log.Errorln("Failed to create chat log directory:", err)
+		return
+	}
+
+	initAPI()
+
+	go func() {
+		for {
+			Prune(time.Now())
+			time.Sleep(pruneInterval)
+		}
+	}()
+
+	log.Infoln("Chat log initialized")
+}
+
+// Open starts logging into the given directory
+func Open(path string) error {
+	fileLock.Lock()
+	defer fileLock.Unlock()
+
+	if file != nil {
+		file.Close()
+		file = nil
+	}
+
+	dir = ""
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return err
+	}
+	dir = path
+	return nil
+}
+
+func Add(entry Entry) {
+	if dir == "" {
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	data = append(data, '\n')
+
+	fileLock.Lock()
+	defer fileLock.Unlock()
+
+	if err := rotate(entry.Time); err != nil {
+		log.Errorln("Failed to open chat log:", err)
+		return
+	}
+
+	n, err := file.Write(data)
+	fileSize += int64(n)
+	if err != nil {
+		log.Errorln("Failed to write chat log:", err)
+	}
+}
+
+// rotate opens a new file if needed, has to be called with the lock held
+func rotate(now time.Time) error {
+	day := now.UTC().Format(dayFormat)
+	maxSize := config.Cfg.ChatLogMaxSize
+
+	if file != nil && day == fileDay && (maxSize <= 0 || fileSize < maxSize) {
+		return nil
+	}
+
+	if file != nil {
+		file.Close()
+		file = nil
+	}
+
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("chat-%s.jsonl", day)
+		if i > 0 {
+			name = fmt.Sprintf("chat-%s.%d.jsonl", day, i)
+		}
+
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if maxSize > 0 && info.Size() >= maxSize {
+			f.Close()
+			continue
+		}
+
+		file = f
+		fileDay = day
+		fileSize = info.Size()
+		return nil
+	}
+}
+
+// logFile is a log file and the day it covers
+type logFile struct {
+	path string
+	day  time.Time
+}
+
+// listFiles returns all log files, oldest first
+func listFiles() []logFile {
+	paths, err := filepath.Glob(filepath.Join(dir, "chat-*.jsonl"))
+	if err != nil {
+		log.Errorln(err)
+		return nil
+	}
+
+	var files []logFile
+	for _, p := range paths {
+		name := strings.TrimPrefix(filepath.Base(p), "chat-")
+		day, err := time.Parse(dayFormat, name[:min(len(name), len(dayFormat))])
+		if err != nil {
+			continue
+		}
+		files = append(files, logFile{path: p, day: day})
+	}
+
+	// rotated files of the same day sort by their index
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].day.Equal(files[j].day) {
+			return files[i].day.Before(files[j].day)
+		}
+		return rotationIndex(files[i].path) < rotationIndex(files[j].path)
+	})
+	return files
+}
+
+func rotationIndex(path string) int {
+	parts := strings.Split(strings.TrimSuffix(filepath.Base(path), ".jsonl"), ".")
+	if len(parts) != 2 {
+		return 0
+	}
+	idx, _ := strconv.Atoi(parts[1])
+	return idx
+}
+
+// Prune deletes log files older than the retention period
+func Prune(now time.Time) {
+	days := config.Cfg.ChatLogRetentionDays
+	if days <= 0 || dir == "" {
+		return
+	}
+
+	cutoff := now.UTC().AddDate(0, 0, -days)
+
+	fileLock.Lock()
+	defer fileLock.Unlock()
+
+	for _, f := range listFiles() {
+		// the file covers the whole day
+		if f.day.AddDate(0, 0, 1).After(cutoff) {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			log.Errorln("Failed to delete old chat log:", err)
+			continue
+		}
+		log.Infoln("Deleted old chat log", filepath.Base(f.path))
+	}
+}
+
+type Query struct {
+	User  string // sender or whisper recipient, ignores case and whitespace
+	From  time.Time
+	To    time.Time
+	Text  string // case insensitive substring
+	Limit int
+}
+
+// Search returns matching entries, newest first
+func Search(q Query) ([]Entry, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("chat log disabled")
+	}
+
+	user := library.NormalizeName(q.User)
+	text := strings.ToLower(q.Text)
+
+	fileLock.Lock()
+	files := listFiles()
+	fileLock.Unlock()
+
+	var result []Entry
+
+	for i := len(files) - 1; i >= 0 && len(result) < q.Limit; i-- {
+		f := files[i]
+		if !q.From.IsZero() && f.day.AddDate(0, 0, 1).Before(q.From) {
+			break
+		}
+		if !q.To.IsZero() && f.day.After(q.To) {
+			continue
+		}
+
+		entries, err := readFile(f.path)
+		if err != nil {
+			return nil, err
+		}
+
+		for j := len(entries) - 1; j >= 0 && len(result) < q.Limit; j-- {
+			e := entries[j]
+
+			if !q.From.IsZero() && e.Time.Before(q.From) {
+				continue
+			}
+			if !q.To.IsZero() && e.Time.After(q.To) {
+				continue
+			}
+			if user != "" && library.NormalizeName(e.FromName) != user && library.NormalizeName(e.To) != user {
+				continue
+			}
+			if text != "" && !strings.Contains(strings.ToLower(e.Txt), text) {
+				continue
+			}
+			result = append(result, e)
+		}
+	}
+
+	return result, nil
+}
+
+func readFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue // partially written line
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, scanner.Err()
+}
@@ -0,0 +1,153 @@
+package chatlog_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"s2dnglobby/chatlog"
+	"s2dnglobby/config"
+	"s2dnglobby/events"
+)
+
+func openLog(t *testing.T, maxSize int64, retentionDays int) string {
+	dir := t.TempDir()
+
+	size, days := config.Cfg.ChatLogMaxSize, config.Cfg.ChatLogRetentionDays
+	config.Cfg.ChatLogMaxSize, config.Cfg.ChatLogRetentionDays = maxSize, retentionDays
+	t.Cleanup(func() {
+		config.Cfg.ChatLogMaxSize, config.Cfg.ChatLogRetentionDays = size, days
+	})
+
+	if err := chatlog.Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	// close the current file before the temp dir gets removed
+	t.Cleanup(func() { chatlog.Open(t.TempDir()) })
+	return dir
+}
+
+func files(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestRotation(t *testing.T) {
+	dir := openLog(t, 100, 0)
+
+	day := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		chatlog.Add(chatlog.Entry{Time: day.Add(time.Duration(i) * time.Minute), FromName: "alice", Mode: chatlog.ModeGlobal, Txt: "a line long enough to fill the file"})
+	}
+	chatlog.Add(chatlog.Entry{Time: day.AddDate(0, 0, 1), FromName: "alice", Mode: chatlog.ModeGlobal, Txt: "next day"})
+
+	want := []string{"chat-2023-01-02.1.jsonl", "chat-2023-01-02.2.jsonl", "chat-2023-01-02.jsonl", "chat-2023-01-03.jsonl"}
+	got := files(t, dir)
+	if len(got) != len(want) {
+		t.Fatalf("expected files %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected files %v, got %v", want, got)
+		}
+	}
+
+	res, err := chatlog.Search(chatlog.Query{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 4 || res[0].Txt != "next day" || !res[3].Time.Equal(day) {
+		t.Errorf("expected all entries newest first, got %+v", res)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	dir := openLog(t, 0, 7)
+
+	for _, name := range []string{"chat-2023-01-01.jsonl", "chat-2023-01-01.1.jsonl", "chat-2023-01-09.jsonl", "chat-2023-01-10.jsonl", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chatlog.Prune(time.Date(2023, 1, 17, 12, 0, 0, 0, time.UTC))
+
+	got := files(t, dir)
+	if len(got) != 2 || got[0] != "chat-2023-01-10.jsonl" || got[1] != "notes.txt" {
+		t.Errorf("unexpected files after pruning: %v", got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	openLog(t, 0, 0)
+
+	start := time.Date(2023, 3, 1, 20, 0, 0, 0, time.UTC)
+	entries := []chatlog.Entry{
+		{FromName: "Alice", Mode: chatlog.ModeGlobal, Txt: "Hello everyone"},
+		{FromName: "Bob", Mode: chatlog.ModeWhisper, To: "Alice", Txt: "hi alice"},
+		{FromName: "Carol", Mode: chatlog.ModeGlobal, Txt: "anyone up for a game?"},
+		{FromName: "Alice", Mode: chatlog.ModeGlobal, Txt: "hello again"},
+	}
+	for i, e := range entries {
+		e.Time = start.Add(time.Duration(i) * time.Hour) // the last one is on the next day
+		chatlog.Add(e)
+	}
+
+	tests := []struct {
+		query chatlog.Query
+		want  []string
+	}{
+		{chatlog.Query{User: "ALICE", Limit: 10}, []string{"hello again", "hi alice", "Hello everyone"}},
+		{chatlog.Query{Text: "HELLO", Limit: 10}, []string{"hello again", "Hello everyone"}},
+		{chatlog.Query{User: "alice", Limit: 1}, []string{"hello again"}},
+		{chatlog.Query{From: start.Add(30 * time.Minute), To: start.Add(150 * time.Minute), Limit: 10}, []string{"anyone up for a game?", "hi alice"}},
+		{chatlog.Query{User: "dave", Limit: 10}, nil},
+	}
+
+	for _, tt := range tests {
+		res, err := chatlog.Search(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range res {
+			got = append(got, e.Txt)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%+v: expected %q, got %q", tt.query, tt.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%+v: expected %q, got %q", tt.query, tt.want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	openLog(t, 0, 0)
+
+	bus := events.NewBus(0)
+	chatlog.Subscribe(bus)
+
+	bus.Publish(events.ChatPosted{Time: time.Now(), FromName: "alice", Mode: chatlog.ModeWhisper, To: "bob", Txt: "psst"})
+	bus.Flush()
+
+	res, err := chatlog.Search(chatlog.Query{User: "bob", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Txt != "psst" || res[0].Mode != chatlog.ModeWhisper {
+		t.Errorf("expected the whisper to be logged, got %+v", res)
+	}
+}
@@ -0,0 +1,17 @@
+package chatlog
+
+import "s2dnglobby/events"
+
+// Subscribe writes all chat messages to the log
+func Subscribe(b *events.Bus) {
+	events.On(b, "chatlog", func(e events.ChatPosted) {
+		Add(Entry{
+			Time:     e.Time,
+			FromId:   e.FromId,
+			FromName: e.FromName,
+			Mode:     e.Mode,
+			To:       e.To,
+			Txt:      e.Txt,
+		})
+	})
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 )
 
 const DEBUGGING = true
@@ -11,7 +12,15 @@ const SERVER_PORT = 6800 // port of the lobby server
 const API_PORT = 6801 // port of the HTTP API of lobby server
 const CONTROLLER_PORT = 6802 // port of FRP controller
 
-const Patchlevel = 11757
+const Patchlevel = 11757 // default accepted patchlevel
+
+const DataDir = "data" // persistent state of the lobby server
+const SaveDelay = 5 * time.Second // frequently changed files get written at most this often
+
+const QuarantineMaxEntries = 500 // max amount of unknown messages kept on disk
+const QuarantineContextSize = 8 // amount of preceding messages stored per entry
+
+const HistoryMaxEntries = 5000 // started games kept in the game history
 
 const VersionMaj = 0;
 const VersionMin = 2;
@@ -25,7 +34,7 @@ v%d.%d-alpha %s
 
 Join our Discord: https://discord.gg/UAXH3VS9Qy`
 
-const ConfigFileName = ""
+const ConfigFileName = "config.json"
 
 func GetMOTD(name string) string {
 	return fmt.Sprintf(
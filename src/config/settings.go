@@ -0,0 +1,190 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+/*
+* Runtime settings, loaded from ConfigFileName if it exists.
+* Missing fields keep their default value.
+ */
+
+const (
+	AccountModeOpen = "open" // accept any credentials
+	AccountModeFile = "file" // check credentials against the account file
+)
+
+const (
+	KeyValidatorAll       = "all"       // accept every CD key
+	KeyValidatorFormat    = "format"    // reject malformed keys, there is no checksum
+	KeyValidatorAllowlist = "allowlist" // accept keys listed in KeyAllowlistFile
+)
+
+// what happens if a nickname is already logged in
+const (
+	DuplicateReject = "reject" // reject the new login
+	DuplicateKick   = "kick"   // disconnect the old session
+	DuplicateSuffix = "suffix" // guests get a numbered name, everyone else gets rejected
+)
+
+// who gets a chat notice about logins and logouts
+const (
+	LoginNoticesAll     = "all"     // everyone in the chat
+	LoginNoticesFriends = "friends" // only friends of the user
+)
+
+const DefaultChatHistorySize = 50
+
+// Webhook posts lobby events to an HTTP endpoint
+type Webhook struct {
+	URL          string
+	Events       []string          // event kinds, e.g. ServerCreated
+	Keywords     []string          // ChatPosted only gets posted if the text contains one of them
+	Templates    map[string]string // event kind -> body template, the default is the event as JSON
+	Secret       string            // signs the body with HMAC-SHA256
+	Retries      *int              // missing uses the default, 0 disables retries
+	RetryDelayMs int               // doubled after every failed try
+	QueueSize    int               // pending posts, further events get dropped
+}
+
+// IRC relays the global chat to an IRC channel and back
+type IRC struct {
+	Server           string // host:port, empty disables the bridge
+	TLS              bool
+	Password         string
+	Nick             string
+	Channel          string
+	Prefix           string            // put in front of IRC nicks in the lobby chat
+	FromId           uint32            // sender of relayed IRC lines, 0 is the system
+	Nicks            map[string]string // IRC nick -> name shown in the lobby
+	FloodDelayMs     int               // minimal delay between lines sent to IRC, at least 500
+	QueueSize        int               // lines waiting to be sent to IRC, further lines get dropped
+	ReconnectDelayMs int               // at least 1000, doubled after every failed connect, up to 5 minutes
+}
+
+type Settings struct {
+	AccountMode string
+	AllowGuests bool // let unknown accounts log in as guest in file mode
+
+	DuplicateLogin string
+	ReservedNames  []string // nicknames which could be mistaken for the system
+
+	KeyValidator      string
+	KeyAllowlistFile  string
+	MaxAccountsPerKey int // 0 means unlimited
+
+	LoginNotices string
+
+	WhisperMode    uint32 // ChatMessage Mode the client uses for private chat, 0 disables it
+	ChatFilterFile string // rules of the chat filter, reloaded on change
+
+	ChatHistorySize   int  // global chat messages kept for replay
+	ChatHistoryReplay int  // messages sent to a new chat observer
+	ChatHistoryMarker bool // frame the replayed messages with marker lines
+
+	ChatLogMaxSize       int64 // bytes until a new log file gets started
+	ChatLogRetentionDays int   // older log files get deleted, 0 keeps them forever
+
+	Patchlevels           []uint32            // client versions allowed to log in
+	CompatiblePatchlevels map[uint32][]uint32 // client patchlevel -> other host patchlevels it can join
+	VersionStrings        map[uint32]string   // client patchlevel -> Version of game servers it receives
+	UpdateURL             string              // shown to clients with an unsupported patchlevel
+
+	ServerTTLMinutes        int  // open games without update get removed, 0 disables it
+	RunningServerTTLMinutes int  // same for running games
+	ServerProbe             bool // check if open games are reachable
+	ServerProbeFailures     int  // failed probes in a row until the game gets removed
+
+	AdminToken string   // token for the admin HTTP API, empty disables it
+	Moderators []string // accounts allowed to moderate from chat (file mode only)
+
+	QueueTimeoutMinutes int              // players leave the quick match queue after this time, 0 uses the default
+	GameModeNames       map[string]uint8 // names for GameMode values in /queue, e.g. "ffa"
+
+	EventQueueSize int // events waiting per bus subscriber, further events get dropped
+
+	Webhooks []Webhook
+	IRC      IRC
+}
+
+var Cfg = Settings{
+	AccountMode:    AccountModeOpen,
+	DuplicateLogin: DuplicateReject,
+	ReservedNames:  []string{"system", "server", "lobby", "admin", "moderator"},
+	LoginNotices:   LoginNoticesAll,
+
+	KeyValidator:     KeyValidatorAll,
+	KeyAllowlistFile: "cdkeys.txt",
+
+	ChatFilterFile: "chatfilter.json",
+
+	ChatHistorySize:   DefaultChatHistorySize,
+	ChatHistoryReplay: 10,
+	ChatHistoryMarker: true,
+
+	ChatLogMaxSize:       10 << 20,
+	ChatLogRetentionDays: 90,
+
+	Patchlevels: []uint32{Patchlevel},
+
+	ServerTTLMinutes:        0,
+	RunningServerTTLMinutes: 0,
+	ServerProbeFailures:     3,
+
+	QueueTimeoutMinutes: 30,
+
+	EventQueueSize: 10000,
+
+	IRC: IRC{
+		Nick:             "s2lobby",
+		Prefix:           "[IRC] ",
+		FloodDelayMs:     1000,
+		QueueSize:        50,
+		ReconnectDelayMs: 5000,
+	},
+}
+
+func LoadSettings() error {
+	data, err := os.ReadFile(ConfigFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, &Cfg); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", ConfigFileName, err)
+	}
+
+	switch Cfg.AccountMode {
+	case AccountModeOpen, AccountModeFile:
+	default:
+		return fmt.Errorf("unknown AccountMode: %s", Cfg.AccountMode)
+	}
+
+	switch Cfg.DuplicateLogin {
+	case DuplicateReject, DuplicateKick, DuplicateSuffix:
+	default:
+		return fmt.Errorf("unknown DuplicateLogin policy: %s", Cfg.DuplicateLogin)
+	}
+
+	switch Cfg.LoginNotices {
+	case LoginNoticesAll, LoginNoticesFriends:
+	default:
+		return fmt.Errorf("unknown LoginNotices: %s", Cfg.LoginNotices)
+	}
+
+	if len(Cfg.Patchlevels) == 0 {
+		return fmt.Errorf("Patchlevels must not be empty")
+	}
+
+	if Cfg.IRC.Server != "" && (Cfg.IRC.Nick == "" || Cfg.IRC.Channel == "") {
+		return fmt.Errorf("IRC needs Nick and Channel")
+	}
+
+	return nil
+}
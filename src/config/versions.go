@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+/*
+* Client versions are identified by their patchlevel.
+* Clients only see and join servers hosted by a compatible patchlevel,
+* a patchlevel is always compatible to itself.
+ */
+
+func AcceptsPatchlevel(patchlevel uint32) bool {
+	return slices.Contains(Cfg.Patchlevels, patchlevel)
+}
+
+// Compatible checks if a client can see and join a server hosted with the given patchlevel
+func Compatible(client uint32, host uint32) bool {
+	return client == host || slices.Contains(Cfg.CompatiblePatchlevels[client], host)
+}
+
+// VersionString is the Version of game servers sent to the client
+func VersionString(client uint32, hostVersion string) string {
+	if v, ok := Cfg.VersionStrings[client]; ok {
+		return v
+	}
+	return hostVersion
+}
+
+// PatchlevelMessage explains the client why its patchlevel got rejected
+func PatchlevelMessage(patchlevel uint32) string {
+	newest := slices.Max(Cfg.Patchlevels)
+
+	var msg string
+	if patchlevel < newest {
+		msg = fmt.Sprintf("Your game version (patchlevel %d) is outdated, please update to patchlevel %d", patchlevel, newest)
+	} else {
+		msg = fmt.Sprintf("Your game version (patchlevel %d) is not supported by this lobby", patchlevel)
+	}
+
+	if Cfg.UpdateURL != "" {
+		msg += ": " + Cfg.UpdateURL
+	}
+	return msg
+}
@@ -0,0 +1,71 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"s2dnglobby/config"
+)
+
+// restoreConfig resets the global settings after the test
+func restoreConfig(t *testing.T) {
+	saved := config.Cfg
+	t.Cleanup(func() { config.Cfg = saved })
+}
+
+func TestCompatible(t *testing.T) {
+	restoreConfig(t)
+	config.Cfg.Patchlevels = []uint32{11757, 11800}
+	config.Cfg.CompatiblePatchlevels = map[uint32][]uint32{
+		11800: {11757},
+	}
+
+	cases := []struct {
+		client, host uint32
+		want         bool
+	}{
+		{11757, 11757, true},
+		{11800, 11800, true},
+		{11800, 11757, true},
+		{11757, 11800, false},
+		{11700, 11757, false},
+	}
+
+	for _, c := range cases {
+		if got := config.Compatible(c.client, c.host); got != c.want {
+			t.Errorf("Compatible(%d, %d) = %v, want %v", c.client, c.host, got, c.want)
+		}
+	}
+}
+
+func TestPatchlevelMessage(t *testing.T) {
+	restoreConfig(t)
+	config.Cfg.Patchlevels = []uint32{11757, 11800}
+	config.Cfg.UpdateURL = "https://example.com/update"
+
+	if !config.AcceptsPatchlevel(11757) || config.AcceptsPatchlevel(11700) {
+		t.Fatal("wrong accepted patchlevels")
+	}
+
+	msg := config.PatchlevelMessage(11700)
+	if !strings.Contains(msg, "outdated") || !strings.Contains(msg, "11800") || !strings.HasSuffix(msg, config.Cfg.UpdateURL) {
+		t.Errorf("unexpected message for old client: %s", msg)
+	}
+
+	msg = config.PatchlevelMessage(11900)
+	if !strings.Contains(msg, "not supported") {
+		t.Errorf("unexpected message for new client: %s", msg)
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	restoreConfig(t)
+	config.Cfg.VersionStrings = map[uint32]string{11800: "gb_11800"}
+
+	if v := config.VersionString(11800, ""); v != "gb_11800" {
+		t.Errorf("got %q", v)
+	}
+	if v := config.VersionString(11757, "host"); v != "host" {
+		t.Errorf("got %q", v)
+	}
+}
@@ -0,0 +1,33 @@
+package events
+
+import (
+	"net/http"
+	"strconv"
+
+	"s2dnglobby/library"
+)
+
+const recentEvents = 500
+const defaultEventLimit = 100
+
+func InitEventAPI(b *Bus) {
+	r := NewRecorder(b, recentEvents)
+
+	// recent events, newest first: ?limit=<n>
+	http.HandleFunc("/api/admin/events", library.AdminOnly(func(w http.ResponseWriter, req *http.Request) {
+		limit := defaultEventLimit
+		if v := req.URL.Query().Get("limit"); v != "" {
+			var err error
+			if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+		library.WriteJSONResponse(w, r.Recent(limit))
+	}))
+
+	// number of events per kind since the start
+	http.HandleFunc("/api/admin/events/stats", library.AdminOnly(func(w http.ResponseWriter, req *http.Request) {
+		library.WriteJSONResponse(w, r.Stats())
+	}))
+}
@@ -0,0 +1,180 @@
+package events
+
+import (
+	"sync"
+
+	"s2dnglobby/library"
+)
+
+var log = library.GetLogger("Events")
+
+/*
+* In-process event bus. Publish never blocks, every subscriber gets the events
+* in publish order on its own goroutine, so a slow subscriber only delays itself.
+* Events beyond the queue size of a subscriber get dropped.
+ */
+
+const defaultQueueSize = 10000
+const queueWarnSize = 1000
+
+type Bus struct {
+	subs      map[int]*subscriber
+	nextId    int
+	queueSize int
+	lock      sync.Mutex
+}
+
+type subscriber struct {
+	name    string
+	handler func(Event)
+
+	queue     []Event
+	queueSize int
+	dropped   int // since the queue was last empty
+	pending   sync.WaitGroup
+	closed    bool
+	cond      *sync.Cond
+	lock      sync.Mutex
+}
+
+// NewBus creates a bus with the given queue size per subscriber, 0 uses the default
+func NewBus(queueSize int) *Bus {
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	return &Bus{subs: make(map[int]*subscriber), queueSize: queueSize}
+}
+
+// Subscribe delivers all events to the handler until the returned function is called
+func (b *Bus) Subscribe(name string, handler func(Event)) (unsubscribe func()) {
+	s := &subscriber{name: name, handler: handler, queueSize: b.queueSize}
+	s.cond = sync.NewCond(&s.lock)
+
+	b.lock.Lock()
+	id := b.nextId
+	b.nextId++
+	b.subs[id] = s
+	b.lock.Unlock()
+
+	go s.run()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.lock.Lock()
+			delete(b.subs, id)
+			b.lock.Unlock()
+			s.close()
+		})
+	}
+}
+
+// On subscribes to a single event type
+func On[T Event](b *Bus, name string, handler func(T)) (unsubscribe func()) {
+	return b.Subscribe(name, func(e Event) {
+		if t, ok := e.(T); ok {
+			handler(t)
+		}
+	})
+}
+
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, s := range b.subs {
+		s.push(e)
+	}
+}
+
+// Flush waits until all events published so far are handled
+func (b *Bus) Flush() {
+	b.lock.Lock()
+	subs := make([]*subscriber, 0, len(b.subs))
+	for _, s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.lock.Unlock()
+
+	for _, s := range subs {
+		s.pending.Wait()
+	}
+}
+
+func (s *subscriber) push(e Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return
+	}
+	if len(s.queue) >= s.queueSize {
+		s.dropped++
+		if s.dropped == 1 {
+			log.Errorln("Queue of subscriber", s.name, "is full, dropping events")
+		}
+		return
+	}
+	s.pending.Add(1)
+	s.queue = append(s.queue, e)
+	if len(s.queue) == queueWarnSize {
+		log.Errorln("Subscriber", s.name, "is falling behind,", len(s.queue), "events queued")
+	}
+	s.cond.Signal()
+}
+
+func (s *subscriber) close() {
+	s.lock.Lock()
+	s.closed = true
+	s.cond.Signal()
+	s.lock.Unlock()
+}
+
+func (s *subscriber) run() {
+	for {
+		s.lock.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.queue) == 0 {
+			s.lock.Unlock()
+			return
+		}
+		e := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		if len(s.queue) == 0 && s.dropped > 0 {
+			log.Errorln("Subscriber", s.name, "caught up, dropped", s.dropped, "events")
+			s.dropped = 0
+		}
+		s.lock.Unlock()
+
+		s.deliver(e)
+		s.pending.Done()
+	}
+}
+
+func (s *subscriber) deliver(e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorln("Subscriber", s.name, "panicked on", e.Kind()+":", r)
+		}
+	}()
+	s.handler(e)
+}
+
+// LogEvents logs every event on debug level, without the text of whispers
+func LogEvents(b *Bus) {
+	b.Subscribe("log", func(e Event) {
+		// chatlog.ModeWhisper, chatlog imports this package
+		if c, ok := e.(ChatPosted); ok && c.Mode == "whisper" {
+			c.Txt = "[redacted]"
+			e = c
+		}
+		log.Debugln("Event", e.Kind(), e)
+	})
+}
@@ -0,0 +1,163 @@
+package events_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"s2dnglobby/events"
+)
+
+func TestOrderedDelivery(t *testing.T) {
+	bus := events.NewBus(0)
+
+	var got []uint32
+	events.On(bus, "test", func(e events.UserLoggedIn) {
+		got = append(got, e.Uid)
+	})
+
+	for i := uint32(0); i < 100; i++ {
+		bus.Publish(events.UserLoggedIn{Uid: i})
+		bus.Publish(events.UserLoggedOut{Uid: i}) // filtered by type
+	}
+	bus.Flush()
+
+	if len(got) != 100 {
+		t.Fatalf("got %d events, want 100", len(got))
+	}
+	for i, uid := range got {
+		if uid != uint32(i) {
+			t.Fatalf("event %d out of order: %d", i, uid)
+		}
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	bus := events.NewBus(0)
+
+	var lock sync.Mutex
+	count := 0
+	unsubscribe := bus.Subscribe("test", func(events.Event) {
+		lock.Lock()
+		count++
+		lock.Unlock()
+	})
+
+	bus.Publish(events.ChatPosted{Txt: "a"})
+	bus.Flush()
+	unsubscribe()
+	unsubscribe() // has to be safe
+	bus.Publish(events.ChatPosted{Txt: "b"})
+	bus.Flush()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if count != 1 {
+		t.Errorf("got %d events, want 1", count)
+	}
+}
+
+func TestSlowSubscriberDoesNotBlock(t *testing.T) {
+	bus := events.NewBus(0)
+
+	release := make(chan struct{})
+	bus.Subscribe("slow", func(events.Event) {
+		<-release
+	})
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			bus.Publish(events.PlayerJoined{Uid: uint32(i)})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked on a slow subscriber")
+	}
+	close(release)
+	bus.Flush()
+}
+
+func TestFullQueueDrops(t *testing.T) {
+	bus := events.NewBus(3)
+
+	started := make(chan struct{}, 20)
+	release := make(chan struct{})
+	var got []uint32
+	events.On(bus, "slow", func(e events.PlayerJoined) {
+		started <- struct{}{}
+		<-release
+		got = append(got, e.Uid)
+	})
+
+	bus.Publish(events.PlayerJoined{Uid: 0})
+	<-started
+	for i := uint32(1); i < 10; i++ {
+		bus.Publish(events.PlayerJoined{Uid: i})
+	}
+	close(release)
+	bus.Flush()
+
+	// delivered again once the queue has room
+	bus.Publish(events.PlayerJoined{Uid: 10})
+	bus.Flush()
+
+	want := []uint32{0, 1, 2, 3, 10}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPanickingSubscriber(t *testing.T) {
+	bus := events.NewBus(0)
+
+	bus.Subscribe("panic", func(events.Event) {
+		panic("boom")
+	})
+
+	var got int
+	events.On(bus, "test", func(events.ServerCreated) {
+		got++
+	})
+
+	bus.Publish(events.ServerCreated{})
+	bus.Publish(events.ServerCreated{})
+	bus.Flush()
+
+	if got != 2 {
+		t.Errorf("got %d events, want 2", got)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	bus := events.NewBus(0)
+	r := events.NewRecorder(bus, 3)
+
+	for i := uint32(0); i < 5; i++ {
+		bus.Publish(events.PlayerJoined{Uid: i})
+	}
+	bus.Publish(events.PlayerLeft{Uid: 4})
+	bus.Flush()
+
+	recent := r.Recent(10)
+	if len(recent) != 3 {
+		t.Fatalf("got %d recent events, want 3", len(recent))
+	}
+	if recent[0].Kind != "PlayerLeft" || recent[2].Event.(events.PlayerJoined).Uid != 3 {
+		t.Errorf("unexpected recent events: %+v", recent)
+	}
+
+	stats := r.Stats()
+	if stats.Counts["PlayerJoined"] != 5 || stats.Counts["PlayerLeft"] != 1 {
+		t.Errorf("unexpected counts: %v", stats.Counts)
+	}
+}
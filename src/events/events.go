@@ -0,0 +1,107 @@
+package events
+
+import "time"
+
+/*
+* Events published by the lobby. They carry copies of the data,
+* so subscribers never touch the lobby state of the publisher.
+ */
+
+type Event interface {
+	Kind() string
+}
+
+type UserLoggedIn struct {
+	Time       time.Time
+	Name       string
+	Uid        uint32
+	Guest      bool
+	Patchlevel uint32
+}
+
+type UserLoggedOut struct {
+	Time  time.Time
+	Name  string
+	Uid   uint32
+	Guest bool
+}
+
+type ChatPosted struct {
+	Time     time.Time
+	FromId   uint32
+	FromName string
+	Mode     string // see chatlog.ModeGlobal, chatlog.ModeWhisper and chatlog.ModeRelay
+	To       string `json:",omitempty"`
+	Txt      string
+}
+
+// ServerInfo is a snapshot of a game server
+type ServerInfo struct {
+	Id         uint32
+	Name       string
+	Host       string
+	OwnerId    uint32
+	Map        string
+	MaxPlayers uint8
+	Players    int
+	AiPlayers  uint8
+	GameMode   uint8
+	Level      uint8
+	Hardcore   bool
+	Running    bool
+	Bridged    bool
+	Private    bool
+}
+
+type ServerCreated struct {
+	Time   time.Time
+	Server ServerInfo
+}
+
+type ServerChanged struct {
+	Time   time.Time
+	Server ServerInfo
+}
+
+type ServerStarted struct {
+	Time    time.Time
+	Server  ServerInfo
+	Players []string // including the host
+}
+
+type ServerRemoved struct {
+	Time   time.Time
+	Server ServerInfo
+	Reason string
+}
+
+type PlayerJoined struct {
+	Time   time.Time
+	Server ServerInfo
+	Name   string
+	Uid    uint32
+}
+
+type PlayerLeft struct {
+	Time   time.Time
+	Server ServerInfo
+	Name   string
+	Uid    uint32
+}
+
+type BridgePortAllocated struct {
+	Time   time.Time
+	Port   int
+	Remote string
+}
+
+func (UserLoggedIn) Kind() string        { return "UserLoggedIn" }
+func (UserLoggedOut) Kind() string       { return "UserLoggedOut" }
+func (ChatPosted) Kind() string          { return "ChatPosted" }
+func (ServerCreated) Kind() string       { return "ServerCreated" }
+func (ServerChanged) Kind() string       { return "ServerChanged" }
+func (ServerStarted) Kind() string       { return "ServerStarted" }
+func (ServerRemoved) Kind() string       { return "ServerRemoved" }
+func (PlayerJoined) Kind() string        { return "PlayerJoined" }
+func (PlayerLeft) Kind() string          { return "PlayerLeft" }
+func (BridgePortAllocated) Kind() string { return "BridgePortAllocated" }
@@ -0,0 +1,76 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Recorder keeps the most recent events and counts all events per kind
+type Recorder struct {
+	recent []Record
+	next   int
+	counts map[string]uint64
+	since  time.Time
+	lock   sync.Mutex
+}
+
+type Record struct {
+	Kind  string
+	Event Event
+}
+
+type Stats struct {
+	Since  time.Time
+	Counts map[string]uint64
+}
+
+func NewRecorder(b *Bus, size int) *Recorder {
+	r := &Recorder{
+		recent: make([]Record, 0, size),
+		counts: make(map[string]uint64),
+		since:  time.Now(),
+	}
+	b.Subscribe("recorder", r.add)
+	return r
+}
+
+func (r *Recorder) add(e Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.counts[e.Kind()]++
+
+	rec := Record{Kind: e.Kind(), Event: e}
+	switch {
+	case cap(r.recent) == 0:
+	case len(r.recent) < cap(r.recent):
+		r.recent = append(r.recent, rec)
+	default:
+		r.recent[r.next] = rec
+		r.next = (r.next + 1) % len(r.recent)
+	}
+}
+
+// Recent returns up to n events, newest first
+func (r *Recorder) Recent(n int) []Record {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	res := make([]Record, 0, min(n, len(r.recent)))
+	for i := 0; i < len(r.recent) && len(res) < n; i++ {
+		j := (r.next - 1 - i + 2*len(r.recent)) % len(r.recent)
+		res = append(res, r.recent[j])
+	}
+	return res
+}
+
+func (r *Recorder) Stats() Stats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	counts := make(map[string]uint64, len(r.counts))
+	for k, v := range r.counts {
+		counts[k] = v
+	}
+	return Stats{Since: r.since, Counts: counts}
+}
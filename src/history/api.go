@@ -0,0 +1,40 @@
+package history
+
+import (
+	"net/http"
+	"strconv"
+
+	"s2dnglobby/library"
+)
+
+const defaultSearchLimit = 50
+
+func initAPI() {
+	// recently started games: ?user=<name>&limit=<n>
+	// Ended is only an approximation, see Session
+	http.HandleFunc("/api/history", handleSearch)
+}
+
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+
+	q := Query{
+		User:  params.Get("user"),
+		Limit: defaultSearchLimit,
+	}
+
+	if v := params.Get("limit"); v != "" {
+		var err error
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	library.WriteJSONResponse(w, Search(q))
+}
@@ -0,0 +1,54 @@
+package history
+
+import (
+	"s2dnglobby/events"
+	"s2dnglobby/library"
+)
+
+// Subscribe records started games from the lobby events, a game ends
+// when the last of its players left it, see Session
+func Subscribe(b *events.Bus) {
+	type running struct {
+		id      uint32
+		players map[string]bool // normalized names
+	}
+	games := make(map[uint32]*running) // by ServerId, only used by the subscriber
+
+	b.Subscribe("history", func(e events.Event) {
+		switch e := e.(type) {
+		case events.ServerStarted:
+			id := Start(Session{
+				Name:      e.Server.Name,
+				Host:      e.Server.Host,
+				HostId:    e.Server.OwnerId,
+				Players:   e.Players,
+				Map:       e.Server.Map,
+				GameMode:  e.Server.GameMode,
+				Level:     e.Server.Level,
+				Hardcore:  e.Server.Hardcore,
+				AiPlayers: e.Server.AiPlayers,
+				Bridged:   e.Server.Bridged,
+				Started:   e.Time,
+			})
+			if len(e.Players) == 0 {
+				return
+			}
+			g := &running{id: id, players: make(map[string]bool)}
+			for _, p := range e.Players {
+				g.players[library.NormalizeName(p)] = true
+			}
+			games[e.Server.Id] = g
+
+		case events.PlayerLeft:
+			g, ok := games[e.Server.Id]
+			if !ok {
+				return
+			}
+			delete(g.players, library.NormalizeName(e.Name))
+			if len(g.players) == 0 {
+				delete(games, e.Server.Id)
+				End(g.id, e.Time)
+			}
+		}
+	})
+}
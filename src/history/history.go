@@ -0,0 +1,141 @@
+package history
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"s2dnglobby/config"
+	"s2dnglobby/library"
+)
+
+var log = library.GetLogger("History")
+
+/*
+* Record of every started game. The lobby does not know when a game ends,
+* the end is approximated by the time the last player hosted or joined
+* another game or disconnected. Players who stay in the lobby without doing
+* either keep the game running, so the end can be late or missing.
+ */
+
+type Session struct {
+	Id        uint32
+	Name      string
+	Host      string
+	HostId    uint32
+	Players   []string // including the host
+	Map       string
+	GameMode  uint8
+	Level     uint8
+	Hardcore  bool
+	AiPlayers uint8
+	Bridged   bool // hosted through the TCP bridge instead of a direct connection
+	Started   time.Time
+	Ended     time.Time `json:",omitempty"` // approximation, zero while any player might still be in the game
+}
+
+// Involves checks if the user hosted or played the game, ignores case and whitespace
+func (s *Session) Involves(name string) bool {
+	name = library.NormalizeName(name)
+	for _, p := range s.Players {
+		if library.NormalizeName(p) == name {
+			return true
+		}
+	}
+	return library.NormalizeName(s.Host) == name
+}
+
+type sessionList struct {
+	LastId   uint32
+	Sessions []*Session
+}
+
+var path string
+var list = &sessionList{}
+var listLock sync.Mutex
+
+func InitHistory() error {
+	path = filepath.Join(config.DataDir, "history.json")
+
+	l := &sessionList{}
+	if err := library.ReadJSON(path, l); err != nil {
+		return fmt.Errorf("failed to load game history: %w", err)
+	}
+	list = l
+
+	initAPI()
+
+	log.Infoln("Game history initialized with", len(list.Sessions), "games")
+	return nil
+}
+
+// Start records a started game and returns its id
+func Start(s Session) uint32 {
+	listLock.Lock()
+	defer listLock.Unlock()
+
+	list.LastId++
+	s.Id = list.LastId
+	if s.Started.IsZero() {
+		s.Started = time.Now()
+	}
+	list.Sessions = append(list.Sessions, &s)
+
+	if over := len(list.Sessions) - config.HistoryMaxEntries; over > 0 {
+		list.Sessions = slices.Delete(list.Sessions, 0, over)
+	}
+
+	save()
+	log.Infoln("Game", s.Id, s.Name, "of", s.Host, "started with", len(s.Players), "players")
+	return s.Id
+}
+
+// End sets the end time of the game if it is still running
+func End(id uint32, now time.Time) {
+	listLock.Lock()
+	defer listLock.Unlock()
+
+	for _, s := range list.Sessions {
+		if s.Id == id && s.Ended.IsZero() {
+			s.Ended = now
+			save()
+			log.Infoln("Game", s.Id, s.Name, "ended after", now.Sub(s.Started).Round(time.Second))
+			return
+		}
+	}
+}
+
+type Query struct {
+	User  string // host or player
+	Limit int
+}
+
+// Search returns matching games, newest first
+func Search(q Query) []Session {
+	listLock.Lock()
+	defer listLock.Unlock()
+
+	var res []Session
+	for i := len(list.Sessions) - 1; i >= 0 && (q.Limit <= 0 || len(res) < q.Limit); i-- {
+		s := list.Sessions[i]
+		if q.User != "" && !s.Involves(q.User) {
+			continue
+		}
+		c := *s
+		c.Players = slices.Clone(s.Players)
+		res = append(res, c)
+	}
+	return res
+}
+
+// save has to be called with the lock held
+func save() {
+	if path == "" {
+		return
+	}
+	if err := library.WriteJSON(path, list); err != nil {
+		log.Errorln("Failed to store game history:", err)
+	}
+}
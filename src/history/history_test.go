@@ -0,0 +1,68 @@
+package history_test
+
+import (
+	"testing"
+	"time"
+
+	"s2dnglobby/events"
+	"s2dnglobby/history"
+)
+
+func TestSessionInvolves(t *testing.T) {
+	s := history.Session{Host: "Host", Players: []string{"Host", "Some Player"}}
+
+	if !s.Involves("host") || !s.Involves("someplayer") {
+		t.Error("host and players should be involved")
+	}
+	if s.Involves("other") {
+		t.Error("other user should not be involved")
+	}
+}
+
+func TestStartEndSearch(t *testing.T) {
+	started := time.Now().Add(-time.Hour)
+
+	a := history.Start(history.Session{Name: "a", Host: "alice", Players: []string{"alice", "bob"}, Started: started})
+	b := history.Start(history.Session{Name: "b", Host: "carol", Players: []string{"carol"}})
+
+	now := time.Now()
+	history.End(a, now)
+	history.End(a, now.Add(time.Hour)) // already ended
+
+	res := history.Search(history.Query{User: "bob"})
+	if len(res) != 1 || res[0].Id != a || !res[0].Ended.Equal(now) {
+		t.Fatalf("unexpected result for bob: %+v", res)
+	}
+
+	res = history.Search(history.Query{Limit: 1})
+	if len(res) != 1 || res[0].Id != b || !res[0].Ended.IsZero() {
+		t.Fatalf("expected newest running game, got %+v", res)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	bus := events.NewBus(0)
+	history.Subscribe(bus)
+
+	started := time.Now().Add(-time.Hour)
+	server := events.ServerInfo{Id: 42, Name: "subscribed", Host: "Dave", Map: "Greenland"}
+
+	bus.Publish(events.ServerStarted{Time: started, Server: server, Players: []string{"Dave", "Erin"}})
+	bus.Publish(events.PlayerLeft{Time: started.Add(time.Minute), Server: events.ServerInfo{Id: 7}, Name: "Dave"}) // other game
+	bus.Publish(events.PlayerLeft{Time: started.Add(time.Minute), Server: server, Name: "dave"})
+	bus.Flush()
+
+	res := history.Search(history.Query{User: "erin"})
+	if len(res) != 1 || res[0].Name != "subscribed" || !res[0].Started.Equal(started) || !res[0].Ended.IsZero() {
+		t.Fatalf("expected running game, got %+v", res)
+	}
+
+	ended := started.Add(30 * time.Minute)
+	bus.Publish(events.PlayerLeft{Time: ended, Server: server, Name: "Erin"})
+	bus.Flush()
+
+	res = history.Search(history.Query{User: "erin"})
+	if len(res) != 1 || !res[0].Ended.Equal(ended) {
+		t.Fatalf("expected game ended by the last player, got %+v", res)
+	}
+}
@@ -0,0 +1,345 @@
+package ircbridge
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"s2dnglobby/chatlog"
+	"s2dnglobby/config"
+	"s2dnglobby/events"
+	"s2dnglobby/library"
+)
+
+var log = library.GetLogger("IRC")
+
+/*
+* Relays the global lobby chat to an IRC channel and the channel back to the lobby.
+* Lines for IRC get queued and sent with a minimal delay, so the bridge does not get
+* kicked for flooding. Lines from IRC are limited as well, to protect the lobby.
+ */
+
+const (
+	maxLineLength     = 400 // bytes of a relayed text, IRC lines are limited to 512
+	maxInboundLength  = 200 // runes of a line relayed to the lobby
+	inboundBurst      = 5   // lines from IRC per inboundWindow
+	inboundWindow     = 10 * time.Second
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 5 * time.Minute
+	minFloodDelay     = 500 * time.Millisecond // below that most servers kick for flooding
+	dialTimeout       = 10 * time.Second
+	readTimeout       = 5 * time.Minute // the server pings more often
+)
+
+// Deliver shows a line from IRC in the lobby chat, the sender identifies the
+// IRC user for the chat filter
+type Deliver func(sender string, name string, txt string, fromId uint32)
+
+type Bridge struct {
+	cfg     config.IRC
+	deliver Deliver
+
+	outgoing chan string
+	joined   atomic.Bool
+
+	conn     net.Conn
+	connLock sync.Mutex
+	nick     string
+
+	inbound      []time.Time
+	inboundDrops int
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func InitIRCBridge(b *events.Bus, deliver Deliver) *Bridge {
+	if config.Cfg.IRC.Server == "" {
+		return nil
+	}
+
+	bridge := New(config.Cfg.IRC, deliver)
+	events.On(b, "irc", func(e events.ChatPosted) {
+		// lines from IRC have ModeRelay, so they do not echo back
+		if e.Mode == chatlog.ModeGlobal {
+			bridge.Relay(e.FromName, e.Txt)
+		}
+	})
+	bridge.Start()
+
+	log.Infoln("IRC bridge to", config.Cfg.IRC.Channel, "on", config.Cfg.IRC.Server)
+	return bridge
+}
+
+func New(cfg config.IRC, deliver Deliver) *Bridge {
+	return &Bridge{
+		cfg:      cfg,
+		deliver:  deliver,
+		outgoing: make(chan string, max(cfg.QueueSize, 1)),
+		nick:     cfg.Nick,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (b *Bridge) Start() {
+	go b.run()
+}
+
+// Close disconnects and stops reconnecting
+func (b *Bridge) Close() {
+	b.once.Do(func() {
+		close(b.stop)
+
+		b.connLock.Lock()
+		if b.conn != nil {
+			b.write("QUIT :lobby shutting down")
+			b.conn.Close()
+		}
+		b.connLock.Unlock()
+	})
+	<-b.done
+}
+
+// Joined reports if lobby lines currently get relayed
+func (b *Bridge) Joined() bool {
+	return b.joined.Load()
+}
+
+// Relay queues a lobby chat line for IRC, lines get dropped while not connected
+func (b *Bridge) Relay(name, txt string) {
+	if !b.joined.Load() {
+		return
+	}
+
+	line := fmt.Sprintf("<%s> %s", sanitize(name), sanitize(txt))
+	for _, part := range split(line, maxLineLength) {
+		select {
+		case b.outgoing <- part:
+		default:
+			log.Errorln("Queue for IRC is full, dropped a line of", name)
+			return
+		}
+	}
+}
+
+func (b *Bridge) run() {
+	defer close(b.done)
+
+	minDelay := max(time.Duration(b.cfg.ReconnectDelayMs)*time.Millisecond, minReconnectDelay)
+	delay := minDelay
+
+	for {
+		registered, err := b.session()
+		b.joined.Store(false)
+
+		select {
+		case <-b.stop:
+			return
+		default:
+		}
+
+		if registered {
+			delay = minDelay
+		}
+		log.Errorln("Disconnected from", b.cfg.Server+":", err, "- reconnecting in", delay)
+
+		select {
+		case <-b.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+func (b *Bridge) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if b.cfg.TLS {
+		return tls.DialWithDialer(dialer, "tcp", b.cfg.Server, nil)
+	}
+	return dialer.Dial("tcp", b.cfg.Server)
+}
+
+// session connects and handles the connection until it breaks,
+// returns if the server accepted the registration
+func (b *Bridge) session() (bool, error) {
+	conn, err := b.dial()
+	if err != nil {
+		return false, err
+	}
+
+	b.connLock.Lock()
+	select {
+	case <-b.stop:
+		b.connLock.Unlock()
+		conn.Close()
+		return false, nil
+	default:
+	}
+	b.conn = conn
+	b.nick = b.cfg.Nick
+	b.connLock.Unlock()
+
+	sessionDone := make(chan struct{})
+	defer func() {
+		close(sessionDone)
+		b.connLock.Lock()
+		b.conn.Close()
+		b.conn = nil
+		b.connLock.Unlock()
+	}()
+
+	if b.cfg.Password != "" {
+		b.send("PASS " + b.cfg.Password)
+	}
+	b.send("NICK " + b.nick)
+	b.send("USER " + b.cfg.Nick + " 0 * :S2 lobby bridge")
+
+	go b.writeLoop(sessionDone)
+
+	registered := false
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return registered, err
+		}
+
+		m := parseLine(line)
+		if m.command == "001" {
+			registered = true
+		}
+		if err := b.handle(m); err != nil {
+			return registered, err
+		}
+	}
+}
+
+func (b *Bridge) handle(m message) error {
+	switch m.command {
+	case "PING":
+		b.send("PONG :" + m.param(0))
+
+	case "001": // welcome
+		b.send("JOIN " + b.cfg.Channel)
+
+	case "433": // nickname in use
+		b.nick += "_"
+		b.send("NICK " + b.nick)
+
+	case "JOIN":
+		if m.nick() == b.nick && strings.EqualFold(m.param(0), b.cfg.Channel) {
+			b.joined.Store(true)
+			log.Infoln("Joined", b.cfg.Channel, "as", b.nick)
+		}
+
+	case "KICK":
+		if m.param(1) == b.nick && strings.EqualFold(m.param(0), b.cfg.Channel) {
+			b.joined.Store(false)
+			log.Errorln("Kicked from", b.cfg.Channel+":", m.param(2))
+			b.send("JOIN " + b.cfg.Channel)
+		}
+
+	case "PRIVMSG":
+		if strings.EqualFold(m.param(0), b.cfg.Channel) {
+			b.receive(m.nick(), m.param(1))
+		}
+
+	case "ERROR":
+		return fmt.Errorf("server error: %s", m.param(0))
+	}
+	return nil
+}
+
+// receive relays a channel message to the lobby
+func (b *Bridge) receive(nick, txt string) {
+	if action, ok := strings.CutPrefix(txt, "\x01ACTION "); ok {
+		txt = "* " + strings.TrimSuffix(action, "\x01")
+	} else if strings.HasPrefix(txt, "\x01") {
+		return // other CTCP
+	}
+
+	txt = strings.TrimSpace(stripFormatting(txt))
+	if txt == "" || !b.allowInbound() {
+		return
+	}
+	if utf8.RuneCountInString(txt) > maxInboundLength {
+		txt = string([]rune(txt)[:maxInboundLength]) + "..."
+	}
+
+	name := nick
+	if mapped, ok := b.cfg.Nicks[nick]; ok {
+		name = mapped
+	}
+	b.deliver("irc:"+nick, b.cfg.Prefix+name, txt, b.cfg.FromId)
+}
+
+// allowInbound limits the lines relayed from IRC to inboundBurst per inboundWindow
+func (b *Bridge) allowInbound() bool {
+	now := time.Now()
+
+	recent := b.inbound[:0]
+	for _, t := range b.inbound {
+		if now.Sub(t) < inboundWindow {
+			recent = append(recent, t)
+		}
+	}
+	b.inbound = recent
+
+	if len(b.inbound) >= inboundBurst {
+		b.inboundDrops++
+		if b.inboundDrops == 1 {
+			log.Infoln("Too many lines from IRC, dropping")
+		}
+		return false
+	}
+	b.inboundDrops = 0
+	b.inbound = append(b.inbound, now)
+	return true
+}
+
+// writeLoop sends the queued lobby lines with the flood delay
+func (b *Bridge) writeLoop(sessionDone chan struct{}) {
+	delay := max(time.Duration(b.cfg.FloodDelayMs)*time.Millisecond, minFloodDelay)
+
+	for {
+		select {
+		case <-sessionDone:
+			return
+		case line := <-b.outgoing:
+			b.send("PRIVMSG " + b.cfg.Channel + " :" + line)
+		}
+
+		select {
+		case <-sessionDone:
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (b *Bridge) send(line string) {
+	b.connLock.Lock()
+	defer b.connLock.Unlock()
+
+	if b.conn != nil {
+		b.write(line)
+	}
+}
+
+// write has to be called with the conn lock held
+func (b *Bridge) write(line string) {
+	b.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	if _, err := fmt.Fprintf(b.conn, "%s\r\n", line); err != nil {
+		log.Errorln("Failed to send to IRC:", err)
+	}
+}
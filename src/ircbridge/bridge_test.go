@@ -0,0 +1,208 @@
+package ircbridge_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"s2dnglobby/config"
+	"s2dnglobby/ircbridge"
+)
+
+// standIn is a minimal IRC server accepting the bridge
+type standIn struct {
+	listener net.Listener
+	conns    chan *client
+}
+
+type client struct {
+	conn  net.Conn
+	lines chan string
+}
+
+func newStandIn(t *testing.T) *standIn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &standIn{listener: l, conns: make(chan *client, 4)}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c := &client{conn: conn, lines: make(chan string, 100)}
+			go func() {
+				r := bufio.NewScanner(conn)
+				for r.Scan() {
+					c.lines <- r.Text()
+				}
+				close(c.lines)
+			}()
+			s.conns <- c
+		}
+	}()
+	return s
+}
+
+func (s *standIn) accept(t *testing.T) *client {
+	select {
+	case c := <-s.conns:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("bridge did not connect")
+	}
+	return nil
+}
+
+// expect waits for a line starting with the prefix
+func (c *client) expect(t *testing.T, prefix string) string {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-c.lines:
+			if !ok {
+				t.Fatalf("connection closed while waiting for %q", prefix)
+			}
+			if strings.HasPrefix(line, prefix) {
+				return line
+			}
+		case <-timeout:
+			t.Fatalf("timeout waiting for %q", prefix)
+		}
+	}
+}
+
+func (c *client) send(format string, v ...any) {
+	fmt.Fprintf(c.conn, format+"\r\n", v...)
+}
+
+// register answers the registration of the bridge and lets it join the channel
+func (c *client) register(t *testing.T, nick string) {
+	c.expect(t, "NICK "+nick)
+	c.expect(t, "USER ")
+	c.send(":irc.test 001 %s :welcome", nick)
+	c.expect(t, "JOIN #s2")
+	c.send(":%s!bridge@localhost JOIN #s2", nick)
+}
+
+type received struct {
+	sender, name, txt string
+	fromId            uint32
+}
+
+func newBridge(t *testing.T, s *standIn) (*ircbridge.Bridge, chan received) {
+	got := make(chan received, 10)
+	b := ircbridge.New(config.IRC{
+		Server:           s.listener.Addr().String(),
+		Nick:             "lobby",
+		Channel:          "#s2",
+		Prefix:           "[IRC] ",
+		FromId:           7,
+		Nicks:            map[string]string{"bob_": "Bob"},
+		QueueSize:        10,
+		ReconnectDelayMs: 10,
+	}, func(sender, name, txt string, fromId uint32) {
+		got <- received{sender, name, txt, fromId}
+	})
+	b.Start()
+	t.Cleanup(b.Close)
+	return b, got
+}
+
+func waitJoined(t *testing.T, b *ircbridge.Bridge) {
+	for i := 0; i < 500 && !b.Joined(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !b.Joined() {
+		t.Fatal("bridge did not join the channel")
+	}
+}
+
+func TestRelay(t *testing.T) {
+	s := newStandIn(t)
+	b, got := newBridge(t, s)
+
+	c := s.accept(t)
+	c.register(t, "lobby")
+	waitJoined(t, b)
+
+	// lobby -> IRC, line breaks must not inject commands
+	b.Relay("Alice", "hello\r\nQUIT :bye")
+	if line := c.expect(t, "PRIVMSG"); line != "PRIVMSG #s2 :<Alice> hello  QUIT :bye" {
+		t.Errorf("unexpected line %q", line)
+	}
+
+	// IRC -> lobby with name mapping and formatting removed
+	c.send(":bob_!bob@host PRIVMSG #s2 :\x02anyone\x02 up for \x0304,01a game?")
+	c.send(":carol!c@host PRIVMSG #s2 :\x01ACTION waves\x01")
+	c.send(":carol!c@host PRIVMSG lobby :private, not relayed")
+
+	want := []received{
+		{"irc:bob_", "[IRC] Bob", "anyone up for a game?", 7},
+		{"irc:carol", "[IRC] carol", "* waves", 7},
+	}
+	for _, w := range want {
+		select {
+		case r := <-got:
+			if r != w {
+				t.Errorf("got %+v, want %+v", r, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("did not receive %+v", w)
+		}
+	}
+
+	// server pings have to be answered
+	c.send("PING :irc.test")
+	c.expect(t, "PONG :irc.test")
+}
+
+func TestReconnect(t *testing.T) {
+	s := newStandIn(t)
+	b, _ := newBridge(t, s)
+
+	c := s.accept(t)
+	c.register(t, "lobby")
+	waitJoined(t, b)
+	c.conn.Close()
+
+	// second connection with the nick in use
+	c = s.accept(t)
+	c.expect(t, "NICK lobby")
+	c.expect(t, "USER ")
+	c.send(":irc.test 433 * lobby :Nickname is already in use")
+	c.expect(t, "NICK lobby_")
+	c.send(":irc.test 001 lobby_ :welcome")
+	c.expect(t, "JOIN #s2")
+	c.send(":lobby_!bridge@localhost JOIN #s2")
+	waitJoined(t, b)
+
+	b.Relay("Alice", "back")
+	c.expect(t, "PRIVMSG #s2 :<Alice> back")
+}
+
+func TestInboundFlood(t *testing.T) {
+	s := newStandIn(t)
+	b, got := newBridge(t, s)
+
+	c := s.accept(t)
+	c.register(t, "lobby")
+	waitJoined(t, b)
+
+	for i := 0; i < 20; i++ {
+		c.send(":spam!s@host PRIVMSG #s2 :line %d", i)
+	}
+	c.send("PING :done")
+	c.expect(t, "PONG :done")
+
+	if n := len(got); n != 5 {
+		t.Errorf("got %d lines in the lobby, want 5", n)
+	}
+}
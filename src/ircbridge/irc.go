@@ -0,0 +1,104 @@
+package ircbridge
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// message is a parsed IRC line: [:prefix] command params... [:trailing]
+type message struct {
+	prefix  string
+	command string
+	params  []string
+}
+
+func parseLine(line string) message {
+	var m message
+
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, ":") {
+		m.prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+
+	for line != "" {
+		line = strings.TrimLeft(line, " ")
+		if strings.HasPrefix(line, ":") {
+			m.params = append(m.params, line[1:])
+			break
+		}
+
+		var p string
+		p, line, _ = strings.Cut(line, " ")
+		if m.command == "" {
+			m.command = strings.ToUpper(p)
+		} else if p != "" {
+			m.params = append(m.params, p)
+		}
+	}
+	return m
+}
+
+func (m message) param(i int) string {
+	if i < len(m.params) {
+		return m.params[i]
+	}
+	return ""
+}
+
+// nick returns the nick of a prefix like nick!user@host
+func (m message) nick() string {
+	nick, _, _ := strings.Cut(m.prefix, "!")
+	return nick
+}
+
+// stripFormatting removes IRC color and style codes
+func stripFormatting(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case 0x02, 0x0F, 0x11, 0x16, 0x1D, 0x1E, 0x1F:
+		case 0x03: // color: \x03[fg[,bg]], up to two digits each
+			i += digits(s[i+1:])
+			if i+2 < len(s) && s[i+1] == ',' && digits(s[i+2:]) > 0 {
+				i += 1 + digits(s[i+2:])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func digits(s string) int {
+	n := 0
+	for n < 2 && n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// sanitize makes sure a lobby text cannot inject IRC commands
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\r', '\n', 0:
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// split cuts the text into pieces of at most n bytes without breaking runes
+func split(s string, n int) []string {
+	var parts []string
+	for len(s) > n {
+		i := n
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		parts = append(parts, s[:i])
+		s = s[i:]
+	}
+	return append(parts, s)
+}
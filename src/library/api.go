@@ -0,0 +1,40 @@
+package library
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"s2dnglobby/config"
+)
+
+var apiLog = GetLogger("API")
+
+// AdminOnly protects the handler with the AdminToken, which has to be sent
+// as "Authorization: Bearer <token>"; without a token the admin API is disabled
+func AdminOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := config.Cfg.AdminToken
+		if token == "" {
+			http.Error(w, "admin API disabled", http.StatusForbidden)
+			return
+		}
+
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			apiLog.Infoln("Unauthorized admin request from", r.RemoteAddr, r.URL.Path)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func WriteJSONResponse(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		apiLog.Errorln("Failed to write response:", err)
+	}
+}
@@ -0,0 +1,60 @@
+package library
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+* Saver runs a save function in the background, at most once per delay,
+* so frequent changes do not rewrite a file in the caller's goroutine every time.
+ */
+
+type Saver struct {
+	delay   time.Duration
+	save    func()
+	pending bool
+	lock    sync.Mutex
+	running sync.Mutex // saves never overlap
+}
+
+func NewSaver(delay time.Duration, save func()) *Saver {
+	return &Saver{delay: delay, save: save}
+}
+
+// Trigger schedules a save, changes until then are saved together
+func (s *Saver) Trigger() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.pending {
+		return
+	}
+	s.pending = true
+	time.AfterFunc(s.delay, s.run)
+}
+
+// Flush saves right away if a save is pending
+func (s *Saver) Flush() {
+	s.lock.Lock()
+	pending := s.pending
+	s.lock.Unlock()
+
+	if pending {
+		s.run()
+	}
+}
+
+func (s *Saver) run() {
+	s.running.Lock()
+	defer s.running.Unlock()
+
+	s.lock.Lock()
+	pending := s.pending
+	s.pending = false
+	s.lock.Unlock()
+
+	if pending {
+		s.save()
+	}
+}
@@ -0,0 +1,31 @@
+package library_test
+
+import (
+	"s2dnglobby/library"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSaverBatchesChanges(t *testing.T) {
+	var saves atomic.Int32
+	s := library.NewSaver(50*time.Millisecond, func() { saves.Add(1) })
+
+	for i := 0; i < 100; i++ {
+		s.Trigger()
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if n := saves.Load(); n != 1 {
+		t.Errorf("saved %d times, want 1", n)
+	}
+
+	s.Trigger()
+	s.Flush()
+	s.Flush() // nothing pending anymore
+	time.Sleep(100 * time.Millisecond)
+
+	if n := saves.Load(); n != 2 {
+		t.Errorf("saved %d times, want 2", n)
+	}
+}
@@ -2,8 +2,10 @@ package library
 
 import (
 	"fmt"
+	"net"
 	"os/exec"
 	"runtime"
+	"strings"
 )
 
 func commandExists(cmd string) bool {
@@ -42,4 +44,19 @@ func clen(n []byte) int {
         }
     }
     return len(n)
-}
\ No newline at end of file
+}
+
+// NormalizeName returns the name used to compare nicknames,
+// comparison ignores case and whitespace
+func NormalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), ""))
+}
+
+// RemoteIP returns the IP of the remote end without port
+func RemoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
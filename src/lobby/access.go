@@ -0,0 +1,65 @@
+package lobby
+
+/*
+* Access control of private games. The client has no field for it,
+* hosts set it up with chat commands. A game is private if it has a password
+* or is invite-only, invited users can always join.
+ */
+
+func (s *Server) SetPassword(password string) {
+	s.accessLock.Lock()
+	s.password = password
+	s.accessLock.Unlock()
+}
+
+func (s *Server) SetInviteOnly(inviteOnly bool) {
+	s.accessLock.Lock()
+	s.inviteOnly = inviteOnly
+	s.accessLock.Unlock()
+}
+
+// MakePublic removes password, invite-only flag and invitations
+func (s *Server) MakePublic() {
+	s.accessLock.Lock()
+	s.password = ""
+	s.inviteOnly = false
+	s.invited = nil
+	s.accessLock.Unlock()
+}
+
+func (s *Server) Invite(uid uint32, invited bool) {
+	s.accessLock.Lock()
+	defer s.accessLock.Unlock()
+
+	if s.invited == nil {
+		s.invited = make(map[uint32]bool)
+	}
+	if invited {
+		s.invited[uid] = true
+	} else {
+		delete(s.invited, uid)
+	}
+}
+
+func (s *Server) IsPrivate() bool {
+	s.accessLock.Lock()
+	defer s.accessLock.Unlock()
+
+	return s.password != "" || s.inviteOnly
+}
+
+// CanJoin checks the invitations and the password given by the user
+func (s *Server) CanJoin(uid uint32, password string) bool {
+	s.accessLock.Lock()
+	defer s.accessLock.Unlock()
+
+	switch {
+	case uid == s.OwnerId || s.invited[uid]:
+		return true
+	case s.inviteOnly:
+		return false
+	case s.password != "":
+		return password == s.password
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package lobby
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Observer uint8
+
+const (
+	ObsUserLogin Observer = iota
+	ObsGlobalChat
+	ObsServerList
+)
+
+// Account is a logged in user. The exported fields are set on login and not changed afterwards,
+// everything else is accessed through the methods.
+type Account struct {
+	Name string
+	//Password string
+	//Cdkey []byte
+	//Keypool int
+
+	Connection *net.TCPConn
+	Uid        uint32 // stable per account, see accounts package
+	Guest      bool
+	Moderator  bool
+	KeyHash    string
+	Patchlevel uint32
+
+	// only used by the goroutine of the connection
+	ChatLeftAt    time.Time         // last de-registration from global chat
+	JoinPasswords map[uint32]string // passwords for private games by ServerId, see /joinpass
+
+	joinedServer atomic.Pointer[Server]
+
+	lock           sync.Mutex
+	observers      [ObsServerList + 1]bool
+	serverFilter   ServerFilter
+	visibleServers map[uint32]bool // servers sent to this observer
+}
+
+func (a *Account) Observes(o Observer) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.observers[o]
+}
+
+func (a *Account) SetObserver(o Observer, enabled bool) {
+	a.lock.Lock()
+	a.observers[o] = enabled
+	a.lock.Unlock()
+}
+
+// ObserveServerList registers the server list observer with the filter, forgetting sent servers
+func (a *Account) ObserveServerList(filter ServerFilter) {
+	a.lock.Lock()
+	a.observers[ObsServerList] = true
+	a.serverFilter = filter
+	a.visibleServers = nil
+	a.lock.Unlock()
+}
+
+func (a *Account) StopServerList() {
+	a.lock.Lock()
+	a.observers[ObsServerList] = false
+	a.visibleServers = nil
+	a.lock.Unlock()
+}
+
+func (a *Account) ServerFilter() ServerFilter {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.serverFilter
+}
+
+// SetVisible remembers if the observer has been sent the server,
+// returns the previous state
+func (a *Account) SetVisible(serverId uint32, visible bool) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.visibleServers == nil {
+		a.visibleServers = make(map[uint32]bool)
+	}
+
+	was := a.visibleServers[serverId]
+	if visible {
+		a.visibleServers[serverId] = true
+	} else {
+		delete(a.visibleServers, serverId)
+	}
+	return was
+}
+
+// JoinedServer returns the game the user has joined, nil if none
+func (a *Account) JoinedServer() *Server {
+	return a.joinedServer.Load()
+}
+
+func (a *Account) SetJoinedServer(s *Server) {
+	a.joinedServer.Store(s)
+}
+
+// LeaveJoinedServer clears the joined game and returns it
+func (a *Account) LeaveJoinedServer() *Server {
+	return a.joinedServer.Swap(nil)
+}
@@ -0,0 +1,104 @@
+package lobby
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"s2dnglobby/config"
+	"s2dnglobby/library"
+)
+
+// ChatEntry is a global chat message, whispers are never stored
+type ChatEntry struct {
+	Time     time.Time
+	FromId   uint32
+	FromName string
+	Txt      string
+}
+
+type ChatHistory struct {
+	path    string
+	size    int
+	entries []ChatEntry // oldest first
+	lock    sync.Mutex
+	saver   *library.Saver
+}
+
+// NewChatHistory loads the history from path, an empty path keeps it in memory only
+func NewChatHistory(path string, size int) *ChatHistory {
+	h := &ChatHistory{
+		path: path,
+		size: size,
+	}
+
+	if path != "" {
+		if err := library.ReadJSON(path, &h.entries); err != nil {
+			log.Errorln("Failed to load chat history:", err)
+		}
+		h.saver = library.NewSaver(config.SaveDelay, h.save)
+	}
+	h.trim()
+	return h
+}
+
+// LoadChatHistory creates the history configured in the settings
+func LoadChatHistory() *ChatHistory {
+	return NewChatHistory(filepath.Join(config.DataDir, "chathistory.json"), config.Cfg.ChatHistorySize)
+}
+
+func (h *ChatHistory) Add(entry ChatEntry) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.entries = append(h.entries, entry)
+	h.trim()
+
+	if h.saver != nil {
+		h.saver.Trigger()
+	}
+}
+
+// Flush writes pending changes to disk
+func (h *ChatHistory) Flush() {
+	if h.saver != nil {
+		h.saver.Flush()
+	}
+}
+
+func (h *ChatHistory) save() {
+	h.lock.Lock()
+	entries := append([]ChatEntry(nil), h.entries...)
+	h.lock.Unlock()
+
+	if err := library.WriteJSON(h.path, entries); err != nil {
+		log.Errorln("Failed to store chat history:", err)
+	}
+}
+
+// Get returns up to n messages posted after since, oldest first
+func (h *ChatHistory) Get(n int, since time.Time) []ChatEntry {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var list []ChatEntry
+	for i := len(h.entries) - 1; i >= 0 && len(list) < n; i-- {
+		e := h.entries[i]
+		if !e.Time.After(since) {
+			break
+		}
+		list = append(list, e)
+	}
+
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+	return list
+}
+
+// trim has to be called with the lock held
+func (h *ChatHistory) trim() {
+	if over := len(h.entries) - h.size; over > 0 {
+		h.entries = append([]ChatEntry(nil), h.entries[over:]...)
+	}
+}
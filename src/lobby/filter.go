@@ -0,0 +1,44 @@
+package lobby
+
+/*
+* Filter of a server list observer, sent with RegObserverServerList.
+* The meaning of the fields is partly guessed:
+* ServerType and RoomId (LobbyId) match exactly, 0 matches everything.
+* Selection is a bitmask, 0 selects everything.
+ */
+
+const (
+	SelectionOpen    = 0x1 // games which are not running
+	SelectionRunning = 0x2 // running games
+	SelectionNotFull = 0x4 // only games with free slots
+)
+
+type ServerFilter struct {
+	ServerType uint8
+	RoomId     uint32
+	Selection  uint32
+}
+
+func (f *ServerFilter) Matches(s *Server) bool {
+	if f.ServerType != 0 && f.ServerType != s.ServerType {
+		return false
+	}
+	if f.RoomId != 0 && f.RoomId != s.LobbyId {
+		return false
+	}
+
+	running := s.Settings().Running
+
+	state := f.Selection & (SelectionOpen | SelectionRunning)
+	if state == SelectionOpen && running {
+		return false
+	}
+	if state == SelectionRunning && !running {
+		return false
+	}
+	if f.Selection&SelectionNotFull != 0 && s.IsFull() {
+		return false
+	}
+
+	return true
+}
@@ -2,149 +2,148 @@ package lobby
 
 import (
 	"net"
-	"s2dnglobby/library"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"s2dnglobby/config"
+	"s2dnglobby/library"
 )
 
 var log = library.GetLogger("Lobby")
 
-type Account struct {
-	Name string
-	//Password string
-	//Cdkey []byte
-	//Keypool int
-	//Patchlevel int
+/*
+* Lobby holds the logged in users and the listed game servers.
+* Users() and Servers() return snapshots, the entries themselves guard their
+* mutable state, so callers never need to hold a lobby lock while iterating.
+ */
 
-	Connection *net.TCPConn
-	Uid uint32
+type Lobby struct {
+	users     map[*net.TCPConn]*Account
+	usersLock sync.RWMutex
+
+	servers         map[*net.TCPConn]*Server // by connection of the host
+	serversLock     sync.RWMutex
+	serverIdCounter atomic.Uint32
+
+	chat  *ChatHistory
+	queue *MatchQueue
+}
 
-	ObsUserLogin bool
-	ObsGlobalChat bool
-	ObsServerList bool
+func New(chat *ChatHistory) *Lobby {
+	if chat == nil {
+		chat = NewChatHistory("", config.DefaultChatHistorySize)
+	}
+	return &Lobby{
+		users:   make(map[*net.TCPConn]*Account),
+		servers: make(map[*net.TCPConn]*Server),
+		chat:    chat,
+		queue:   NewMatchQueue(),
+	}
+}
 
-	JoinedServer *Server
+func (l *Lobby) ChatHistory() *ChatHistory {
+	return l.chat
 }
 
-var users = make(map[*net.TCPConn]*Account)
-var userIdCounter atomic.Uint32
-var usersLock sync.RWMutex
+func (l *Lobby) Queue() *MatchQueue {
+	return l.queue
+}
 
-func AddUser(user *Account) {
-	id := userIdCounter.Add(1)
-	user.Uid = id
+/* users */
 
-	usersLock.Lock()
-	users[user.Connection] = user
-	usersLock.Unlock()
+func (l *Lobby) AddUser(user *Account) {
+	l.usersLock.Lock()
+	l.users[user.Connection] = user
+	l.usersLock.Unlock()
 }
 
-func RemoveUser(conn *net.TCPConn) {
-	usersLock.Lock()
-	delete(users, conn)
-	usersLock.Unlock()
+func (l *Lobby) RemoveUser(conn *net.TCPConn) {
+	l.usersLock.Lock()
+	delete(l.users, conn)
+	l.usersLock.Unlock()
 }
 
-func GetUser(conn *net.TCPConn) (*Account, bool) {
-	usersLock.RLock()
-	val, ok := users[conn]
-	usersLock.RUnlock()
+func (l *Lobby) GetUser(conn *net.TCPConn) (*Account, bool) {
+	l.usersLock.RLock()
+	val, ok := l.users[conn]
+	l.usersLock.RUnlock()
 
 	return val, ok
 }
 
-func GetAllUsers() map[*net.TCPConn]*Account {
-	return users
-}
-
-type Server struct {
-	Name string
-	OwnerId uint32
-	Description string
-	IP string
-	Port uint32
-	ServerType uint8
-	LobbyId uint32
-	Version string
-	MaxPlayers uint8
-	AiPlayers uint8
-	Level uint8
-	GameMode uint8
-	Hardcore bool
-	Map string
-	AutomaticJoin bool
-	Running bool
-	Data []byte
-
-	PropertyMask uint32 // not sure what this is for
-
-	Id uint32
-	players []*net.TCPConn
-	playersLock sync.Mutex
-}
-func (s *Server) AddPlayer(conn *net.TCPConn) {
-	s.playersLock.Lock()
-	s.players = append(s.players, conn)
-	s.playersLock.Unlock()
-}
-func (s *Server) RemovePlayer(conn *net.TCPConn) {
-	var newList []*net.TCPConn
-
-	for _, c := range s.players {
-		if c == conn {
-			continue
+// GetUserByName finds a logged in user, ignoring case and whitespace
+func (l *Lobby) GetUserByName(name string) (*Account, bool) {
+	key := library.NormalizeName(name)
+
+	l.usersLock.RLock()
+	defer l.usersLock.RUnlock()
+
+	for _, u := range l.users {
+		if library.NormalizeName(u.Name) == key {
+			return u, true
 		}
-		newList = append(newList, c)
 	}
-
-	s.playersLock.Lock()
-	s.players = newList
-	s.playersLock.Unlock()
-}
-func (s *Server) GetPlayerCount() int {
-	return len(s.players)
+	return nil, false
 }
-func (s *Server) GetPlayers() []*net.TCPConn {
-	return s.players
+
+// Users returns a snapshot of all logged in users
+func (l *Lobby) Users() []*Account {
+	l.usersLock.RLock()
+	defer l.usersLock.RUnlock()
+
+	list := make([]*Account, 0, len(l.users))
+	for _, u := range l.users {
+		list = append(list, u)
+	}
+	return list
 }
-func (s *Server) IsFull() bool {
-	return s.GetPlayerCount() + int(s.AiPlayers) >= int(s.MaxPlayers)
+
+func (l *Lobby) UserCount() int {
+	l.usersLock.RLock()
+	defer l.usersLock.RUnlock()
+
+	return len(l.users)
 }
 
+/* servers */
 
-var servers = make(map[*net.TCPConn]*Server)
-var serverIdCounter atomic.Uint32
-var serversLock sync.RWMutex
+// AddServer assigns the ServerId and returns the server the host had created before, if any
+func (l *Lobby) AddServer(server *Server) (*Server, bool) {
+	server.Id = l.serverIdCounter.Add(1)
+	server.Touch()
 
-func AddServer(conn *net.TCPConn, server *Server) {
-	id := serverIdCounter.Add(1)
-	server.Id = id
+	l.serversLock.Lock()
+	old, ok := l.servers[server.Host]
+	l.servers[server.Host] = server
+	l.serversLock.Unlock()
 
-	serversLock.Lock()
-	servers[conn] = server
-	serversLock.Unlock()
+	return old, ok
 }
 
-func RemoveServer(conn *net.TCPConn) {
-	serversLock.Lock()
-	delete(servers, conn)
-	serversLock.Unlock()
+func (l *Lobby) RemoveServer(conn *net.TCPConn) (*Server, bool) {
+	l.serversLock.Lock()
+	server, ok := l.servers[conn]
+	delete(l.servers, conn)
+	l.serversLock.Unlock()
+
+	return server, ok
 }
 
-func GetServer(conn *net.TCPConn) (*Server, bool) {
-	serversLock.RLock()
-	val, ok := servers[conn]
-	serversLock.RUnlock()
+// GetServer returns the server hosted by the connection
+func (l *Lobby) GetServer(conn *net.TCPConn) (*Server, bool) {
+	l.serversLock.RLock()
+	val, ok := l.servers[conn]
+	l.serversLock.RUnlock()
 
 	return val, ok
 }
 
-func GetServerById(serverId uint32) (*Server, bool) {
-	serversLock.RLock()
-	defer serversLock.RUnlock()
+func (l *Lobby) GetServerById(serverId uint32) (*Server, bool) {
+	l.serversLock.RLock()
+	defer l.serversLock.RUnlock()
 
-	for _, s := range servers {
+	for _, s := range l.servers {
 		if s.Id == serverId {
 			return s, true
 		}
@@ -152,25 +151,32 @@ func GetServerById(serverId uint32) (*Server, bool) {
 	return nil, false
 }
 
-func GetAllServers() map[*net.TCPConn]*Server {
-	return servers
-}
+// Servers returns a snapshot of all listed servers
+func (l *Lobby) Servers() []*Server {
+	l.serversLock.RLock()
+	defer l.serversLock.RUnlock()
 
-/* Lobby main loops */
+	list := make([]*Server, 0, len(l.servers))
+	for _, s := range l.servers {
+		list = append(list, s)
+	}
+	return list
+}
 
-func InitLobby() {
-	go statsPrinter()
+func (l *Lobby) ServerCount() int {
+	l.serversLock.RLock()
+	defer l.serversLock.RUnlock()
 
-	log.Infoln("Lobby initialized")
+	return len(l.servers)
 }
 
-func statsPrinter() {
+// PrintStats logs the amount of users and servers until the program ends
+func (l *Lobby) PrintStats(interval time.Duration) {
 	for {
-		time.Sleep(10 * time.Second)
+		time.Sleep(interval)
 		log.Infoln(
-			"Connected users:", len(users),
-			"Last UID:", userIdCounter.Load(),
-			"Created rooms:", len(servers),
+			"Connected users:", l.UserCount(),
+			"Created rooms:", l.ServerCount(),
 		)
 	}
 }
@@ -0,0 +1,237 @@
+package lobby_test
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"s2dnglobby/lobby"
+)
+
+func newServer(host *net.TCPConn, maxPlayers uint8) *lobby.Server {
+	s := &lobby.Server{Host: host}
+	s.Update(func(g *lobby.GameSettings) {
+		g.MaxPlayers = maxPlayers
+	})
+	return s
+}
+
+func TestServerExpired(t *testing.T) {
+	s := newServer(nil, 4)
+	later := time.Now().Add(time.Hour)
+
+	if s.Expired(later, 2*time.Hour, 0) {
+		t.Error("open server expired before its TTL")
+	}
+	if !s.Expired(later, 30*time.Minute, 0) {
+		t.Error("open server did not expire after its TTL")
+	}
+	if s.Expired(later, 0, 0) {
+		t.Error("TTL of 0 should never expire")
+	}
+
+	s.Update(func(g *lobby.GameSettings) { g.Running = true })
+	if s.Expired(later, 30*time.Minute, 2*time.Hour) {
+		t.Error("running server should use the running TTL")
+	}
+	if !s.Expired(later, 2*time.Hour, 30*time.Minute) {
+		t.Error("running server did not expire after the running TTL")
+	}
+}
+
+func TestAddServerReplaces(t *testing.T) {
+	l := lobby.New(nil)
+	host := new(net.TCPConn)
+
+	first := newServer(host, 4)
+	if _, ok := l.AddServer(first); ok {
+		t.Fatal("no server should have been replaced")
+	}
+
+	second := newServer(host, 4)
+	old, ok := l.AddServer(second)
+	if !ok || old != first {
+		t.Fatal("first server should have been replaced")
+	}
+	if second.Id == first.Id || l.ServerCount() != 1 {
+		t.Error("replacement needs a new id and must not be listed twice")
+	}
+	if s, ok := l.GetServerById(second.Id); !ok || s != second {
+		t.Error("server not found by id")
+	}
+
+	removed, ok := l.RemoveServer(host)
+	if !ok || removed != second {
+		t.Error("second server should have been removed")
+	}
+	if _, ok := l.RemoveServer(host); ok {
+		t.Error("nothing left to remove")
+	}
+}
+
+func TestLobbiesAreIsolated(t *testing.T) {
+	a, b := lobby.New(nil), lobby.New(nil)
+
+	a.AddUser(&lobby.Account{Name: "alice", Connection: new(net.TCPConn)})
+
+	if _, ok := a.GetUserByName("Alice"); !ok {
+		t.Error("user not found")
+	}
+	if _, ok := b.GetUserByName("alice"); ok || b.UserCount() != 0 {
+		t.Error("user leaked into another lobby")
+	}
+}
+
+func TestServerJoin(t *testing.T) {
+	s := newServer(nil, 3)
+	s.Update(func(g *lobby.GameSettings) { g.AiPlayers = 1 })
+	a, b, c := new(net.TCPConn), new(net.TCPConn), new(net.TCPConn)
+
+	if !s.Join(a) || !s.Join(b) {
+		t.Fatal("join failed")
+	}
+	if !s.Join(a) || s.GetPlayerCount() != 2 {
+		t.Error("joining twice should not add the player again")
+	}
+	if s.Join(c) {
+		t.Error("join of full server succeeded")
+	}
+
+	if !s.RemovePlayer(a) || s.RemovePlayer(a) {
+		t.Error("player should be removed exactly once")
+	}
+	if !s.Join(c) {
+		t.Error("join after leave failed")
+	}
+}
+
+func TestServerJoinConcurrent(t *testing.T) {
+	s := newServer(nil, 8)
+
+	var wg sync.WaitGroup
+	var joined atomic.Int32
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.Join(new(net.TCPConn)) {
+				joined.Add(1)
+			}
+			s.GetPlayers()
+		}()
+	}
+	wg.Wait()
+
+	if joined.Load() != 8 || s.GetPlayerCount() != 8 {
+		t.Errorf("joined %d, count %d, want 8", joined.Load(), s.GetPlayerCount())
+	}
+}
+
+// TestConcurrentAccess mimics handler goroutines and broadcasts, run with -race
+func TestConcurrentAccess(t *testing.T) {
+	l := lobby.New(nil)
+	filter := lobby.ServerFilter{Selection: lobby.SelectionNotFull}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			conn := new(net.TCPConn)
+			user := &lobby.Account{Name: fmt.Sprint("user", i), Connection: conn}
+			l.AddUser(user)
+
+			user.ObserveServerList(filter)
+			user.SetObserver(lobby.ObsGlobalChat, true)
+
+			server := newServer(conn, 4)
+			l.AddServer(server)
+			server.Update(func(g *lobby.GameSettings) { g.Name = "renamed" })
+
+			for _, u := range l.Users() {
+				if u.Observes(lobby.ObsServerList) {
+					f := u.ServerFilter()
+					u.SetVisible(server.Id, f.Matches(server))
+				}
+			}
+			for _, s := range l.Servers() {
+				if s.Join(conn) {
+					user.SetJoinedServer(s)
+				}
+				_ = s.Settings().Name
+			}
+
+			l.ChatHistory().Add(lobby.ChatEntry{Time: time.Now(), FromName: user.Name})
+			l.ChatHistory().Get(5, time.Time{})
+
+			user.StopServerList()
+			if s := user.LeaveJoinedServer(); s != nil {
+				s.RemovePlayer(conn)
+			}
+			l.RemoveServer(conn)
+			l.RemoveUser(conn)
+		}(i)
+	}
+	wg.Wait()
+
+	if l.UserCount() != 0 || l.ServerCount() != 0 {
+		t.Errorf("%d users and %d servers left", l.UserCount(), l.ServerCount())
+	}
+}
+
+func TestServerAccess(t *testing.T) {
+	s := &lobby.Server{OwnerId: 1}
+
+	if s.IsPrivate() || !s.CanJoin(2, "") {
+		t.Fatal("new server should be public")
+	}
+
+	s.SetPassword("secret")
+	if !s.IsPrivate() || s.CanJoin(2, "") || s.CanJoin(2, "wrong") || !s.CanJoin(2, "secret") {
+		t.Error("password not enforced")
+	}
+	if !s.CanJoin(1, "") {
+		t.Error("owner has to be able to join")
+	}
+
+	s.Invite(3, true)
+	if !s.CanJoin(3, "") {
+		t.Error("invited user should not need the password")
+	}
+
+	s.SetPassword("")
+	s.SetInviteOnly(true)
+	if s.CanJoin(2, "secret") || !s.CanJoin(3, "") {
+		t.Error("invite-only not enforced")
+	}
+
+	s.Invite(3, false)
+	if s.CanJoin(3, "") {
+		t.Error("withdrawn invitation still valid")
+	}
+
+	s.MakePublic()
+	if s.IsPrivate() || !s.CanJoin(2, "") {
+		t.Error("server should be public again")
+	}
+}
+
+func TestChatHistoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chathistory.json")
+
+	h := lobby.NewChatHistory(path, 2)
+	for i := 0; i < 3; i++ {
+		h.Add(lobby.ChatEntry{Time: time.Now(), FromName: fmt.Sprint(i)})
+	}
+	h.Flush()
+
+	got := lobby.NewChatHistory(path, 2).Get(10, time.Time{})
+	if len(got) != 2 || got[0].FromName != "1" || got[1].FromName != "2" {
+		t.Errorf("unexpected history after reload: %+v", got)
+	}
+}
@@ -0,0 +1,228 @@
+package lobby
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+/*
+* Quick match queue. Waiting players get matched with each other, the longest waiting
+* player hosts the game, or get sent to an open game which has AutomaticJoin set.
+ */
+
+const AnyMode = -1 // matches every GameMode
+
+// default number of players for a match if nobody asked for a size
+const DefaultMatchSize = 2
+
+type QueueEntry struct {
+	Uid        uint32
+	Name       string
+	Patchlevel uint32
+	Mode       int // GameMode, AnyMode for any
+	Size       int // players including the host, 0 for any
+	Since      time.Time
+}
+
+// Match is a group of players waiting for their host to create the game
+type Match struct {
+	Host    QueueEntry
+	Players []QueueEntry // without the host
+	Mode    int
+	Size    int
+	Created time.Time
+}
+
+// Compatible reports if a client can join a game of the host patchlevel
+type Compatible func(client, host uint32) bool
+
+type MatchQueue struct {
+	entries []QueueEntry     // oldest first
+	matches map[uint32]Match // pending, by uid of the host
+	lock    sync.Mutex
+}
+
+func NewMatchQueue() *MatchQueue {
+	return &MatchQueue{matches: make(map[uint32]Match)}
+}
+
+func modesMatch(a, b int) bool {
+	return a == AnyMode || b == AnyMode || a == b
+}
+
+// Enqueue adds the player or replaces the wishes of a waiting player
+func (q *MatchQueue) Enqueue(e QueueEntry) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.remove(e.Uid)
+	q.entries = append(q.entries, e)
+}
+
+func (q *MatchQueue) Remove(uid uint32) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.remove(uid)
+}
+
+// remove has to be called with the lock held
+func (q *MatchQueue) remove(uid uint32) bool {
+	i := slices.IndexFunc(q.entries, func(e QueueEntry) bool { return e.Uid == uid })
+	if i < 0 {
+		return false
+	}
+	q.entries = slices.Delete(q.entries, i, i+1)
+	return true
+}
+
+func (q *MatchQueue) Get(uid uint32) (QueueEntry, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	i := slices.IndexFunc(q.entries, func(e QueueEntry) bool { return e.Uid == uid })
+	if i < 0 {
+		return QueueEntry{}, false
+	}
+	return q.entries[i], true
+}
+
+// Entries returns a copy of the waiting players, oldest first
+func (q *MatchQueue) Entries() []QueueEntry {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return slices.Clone(q.entries)
+}
+
+// Expire removes players waiting since before the given time, returns the removed players
+func (q *MatchQueue) Expire(before time.Time) []QueueEntry {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var expired []QueueEntry
+	q.entries = slices.DeleteFunc(q.entries, func(e QueueEntry) bool {
+		if e.Since.Before(before) {
+			expired = append(expired, e)
+			return true
+		}
+		return false
+	})
+	return expired
+}
+
+// ExpireMatches removes pending matches created before the given time and returns them,
+// the caller decides what happens to their players
+func (q *MatchQueue) ExpireMatches(before time.Time) []Match {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var expired []Match
+	for uid, m := range q.matches {
+		if m.Created.Before(before) {
+			expired = append(expired, m)
+			delete(q.matches, uid)
+		}
+	}
+	return expired
+}
+
+// MatchOf returns the pending match the player hosts or waits for
+func (q *MatchQueue) MatchOf(uid uint32) (Match, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for _, m := range q.matches {
+		if m.Host.Uid == uid || slices.ContainsFunc(m.Players, func(e QueueEntry) bool { return e.Uid == uid }) {
+			return m, true
+		}
+	}
+	return Match{}, false
+}
+
+// FormMatch finds a group of waiting players which want the same game,
+// removes them from the queue and keeps the match until the host created the game
+func (q *MatchQueue) FormMatch(compatible Compatible, now time.Time) (Match, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i, host := range q.entries {
+		group := []int{i}
+		mode, size := host.Mode, host.Size
+
+		for j := i + 1; j < len(q.entries); j++ {
+			e := q.entries[j]
+			if !modesMatch(mode, e.Mode) || !compatible(e.Patchlevel, host.Patchlevel) {
+				continue
+			}
+			if e.Size != 0 && (size != 0 && e.Size != size || e.Size <= len(group)) {
+				continue
+			}
+
+			group = append(group, j)
+			if mode == AnyMode {
+				mode = e.Mode
+			}
+			if size == 0 {
+				size = e.Size
+			}
+
+			if len(group) == max(size, DefaultMatchSize) {
+				m := Match{Host: host, Mode: mode, Size: len(group), Created: now}
+				for _, k := range group[1:] {
+					m.Players = append(m.Players, q.entries[k])
+				}
+				for k := len(group) - 1; k >= 0; k-- {
+					q.entries = slices.Delete(q.entries, group[k], group[k]+1)
+				}
+				// the players of a replaced match wait again
+				if old, ok := q.matches[host.Uid]; ok {
+					for _, p := range old.Players {
+						if slices.ContainsFunc(m.Players, func(e QueueEntry) bool { return e.Uid == p.Uid }) {
+							continue
+						}
+						q.remove(p.Uid)
+						q.entries = append(q.entries, p)
+					}
+				}
+				q.matches[host.Uid] = m
+				return m, true
+			}
+		}
+	}
+	return Match{}, false
+}
+
+// TakeMatch returns and forgets the pending match of the host
+func (q *MatchQueue) TakeMatch(hostUid uint32) (Match, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	m, ok := q.matches[hostUid]
+	delete(q.matches, hostUid)
+	return m, ok
+}
+
+// TakeForServer removes waiting players which fit the server, up to its free slots
+func (q *MatchQueue) TakeForServer(server *Server, compatible Compatible) []QueueEntry {
+	g := server.Settings()
+	free := server.FreeSlots()
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var taken []QueueEntry
+	q.entries = slices.DeleteFunc(q.entries, func(e QueueEntry) bool {
+		ok := len(taken) < free &&
+			e.Uid != server.OwnerId &&
+			modesMatch(e.Mode, int(g.GameMode)) &&
+			(e.Size == 0 || e.Size == int(g.MaxPlayers)) &&
+			compatible(e.Patchlevel, server.Patchlevel)
+		if ok {
+			taken = append(taken, e)
+		}
+		return ok
+	})
+	return taken
+}
@@ -0,0 +1,151 @@
+package lobby_test
+
+import (
+	"testing"
+	"time"
+
+	"s2dnglobby/lobby"
+)
+
+func sameVersion(client, host uint32) bool {
+	return client == host
+}
+
+func entry(uid uint32, mode, size int, since time.Time) lobby.QueueEntry {
+	return lobby.QueueEntry{Uid: uid, Name: string(rune('A' + uid)), Patchlevel: 1, Mode: mode, Size: size, Since: since}
+}
+
+func TestFormMatch(t *testing.T) {
+	now := time.Now()
+	q := lobby.NewMatchQueue()
+
+	q.Enqueue(entry(1, 3, 3, now))
+	q.Enqueue(entry(2, 4, 4, now)) // other mode
+	q.Enqueue(entry(3, lobby.AnyMode, 0, now))
+	if _, ok := q.FormMatch(sameVersion, now); ok {
+		t.Fatal("match formed with too few players")
+	}
+
+	old := entry(5, 3, 0, now)
+	old.Patchlevel = 2 // incompatible
+	q.Enqueue(old)
+	q.Enqueue(entry(4, 3, 3, now))
+
+	m, ok := q.FormMatch(sameVersion, now)
+	if !ok {
+		t.Fatal("no match formed")
+	}
+	if m.Host.Uid != 1 || len(m.Players) != 2 || m.Players[0].Uid != 3 || m.Players[1].Uid != 4 {
+		t.Errorf("unexpected match %+v", m)
+	}
+	if m.Mode != 3 || m.Size != 3 {
+		t.Errorf("got mode %d size %d, want 3 and 3", m.Mode, m.Size)
+	}
+
+	if n := len(q.Entries()); n != 2 {
+		t.Errorf("%d players left in the queue, want 2", n)
+	}
+	if _, ok := q.TakeMatch(1); !ok {
+		t.Error("pending match not found")
+	}
+	if _, ok := q.TakeMatch(1); ok {
+		t.Error("pending match returned twice")
+	}
+}
+
+func TestFormMatchDefaultSize(t *testing.T) {
+	now := time.Now()
+	q := lobby.NewMatchQueue()
+
+	q.Enqueue(entry(1, lobby.AnyMode, 0, now))
+	q.Enqueue(entry(2, 5, 0, now))
+
+	m, ok := q.FormMatch(sameVersion, now)
+	if !ok || m.Size != lobby.DefaultMatchSize || m.Mode != 5 {
+		t.Errorf("unexpected match %+v", m)
+	}
+}
+
+func TestTakeForServer(t *testing.T) {
+	now := time.Now()
+	q := lobby.NewMatchQueue()
+
+	s := &lobby.Server{OwnerId: 9, Patchlevel: 1}
+	s.Update(func(g *lobby.GameSettings) {
+		g.GameMode = 2
+		g.MaxPlayers = 4
+		g.AiPlayers = 2 // leaves two free slots
+	})
+
+	q.Enqueue(entry(1, 2, 4, now))
+	q.Enqueue(entry(2, 2, 2, now)) // other size
+	q.Enqueue(entry(3, lobby.AnyMode, 0, now))
+	q.Enqueue(entry(4, 2, 0, now))
+
+	taken := q.TakeForServer(s, sameVersion)
+	if len(taken) != 2 || taken[0].Uid != 1 || taken[1].Uid != 3 {
+		t.Errorf("unexpected players %+v", taken)
+	}
+	if n := len(q.Entries()); n != 2 {
+		t.Errorf("%d players left in the queue, want 2", n)
+	}
+}
+
+func TestQueueExpire(t *testing.T) {
+	now := time.Now()
+	q := lobby.NewMatchQueue()
+
+	q.Enqueue(entry(1, 0, 0, now.Add(-time.Hour)))
+	q.Enqueue(entry(2, 0, 0, now))
+	q.Enqueue(entry(1, 0, 0, now.Add(-2*time.Hour))) // replaces the first entry
+
+	expired := q.Expire(now.Add(-time.Minute))
+	if len(expired) != 1 || expired[0].Uid != 1 {
+		t.Errorf("unexpected expired players %+v", expired)
+	}
+	if _, ok := q.Get(2); !ok {
+		t.Error("waiting player expired too early")
+	}
+}
+
+func TestPendingMatches(t *testing.T) {
+	now := time.Now()
+	q := lobby.NewMatchQueue()
+
+	q.Enqueue(entry(1, 0, 0, now))
+	q.Enqueue(entry(2, 0, 0, now))
+	if _, ok := q.FormMatch(sameVersion, now.Add(-time.Hour)); !ok {
+		t.Fatal("no match formed")
+	}
+
+	for _, uid := range []uint32{1, 2} {
+		if m, ok := q.MatchOf(uid); !ok || m.Host.Uid != 1 {
+			t.Errorf("pending match of %d not found", uid)
+		}
+	}
+	if _, ok := q.MatchOf(3); ok {
+		t.Error("unexpected match of a player without match")
+	}
+
+	// the same host gets matched again, the old player has to wait again
+	q.Enqueue(entry(1, 0, 0, now))
+	q.Enqueue(entry(3, 0, 0, now))
+	m, ok := q.FormMatch(sameVersion, now)
+	if !ok || m.Players[0].Uid != 3 {
+		t.Fatalf("unexpected match %+v", m)
+	}
+	if _, ok := q.Get(2); !ok {
+		t.Error("player of the replaced match is not back in the queue")
+	}
+
+	if expired := q.ExpireMatches(now.Add(-time.Minute)); len(expired) != 0 {
+		t.Errorf("unexpected expired matches %+v", expired)
+	}
+	expired := q.ExpireMatches(now.Add(time.Minute))
+	if len(expired) != 1 || expired[0].Host.Uid != 1 {
+		t.Errorf("unexpected expired matches %+v", expired)
+	}
+	if _, ok := q.MatchOf(1); ok {
+		t.Error("expired match still pending")
+	}
+}
@@ -0,0 +1,142 @@
+package lobby
+
+import (
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// GameSettings are the properties of a server the host can change
+type GameSettings struct {
+	Name         string
+	Description  string
+	MaxPlayers   uint8
+	AiPlayers    uint8
+	Level        uint8
+	GameMode     uint8
+	Hardcore     bool
+	Map          string
+	Running      bool
+	Data         []byte
+	PropertyMask uint32    // not sure what this is for
+	Updated      time.Time // last change by the host
+}
+
+// Server is a game hosted by a user. The exported fields are set on creation,
+// the settings and players are guarded by their locks.
+type Server struct {
+	Id            uint32 // assigned by Lobby.AddServer
+	Host          *net.TCPConn
+	OwnerId       uint32
+	OwnerName     string
+	IP            string
+	Port          uint32
+	ServerType    uint8
+	LobbyId       uint32
+	Version       string
+	AutomaticJoin bool
+	Patchlevel    uint32 // of the host
+
+	settings     GameSettings
+	settingsLock sync.RWMutex
+
+	players     []*net.TCPConn
+	playersLock sync.Mutex
+
+	password   string
+	inviteOnly bool
+	invited    map[uint32]bool // uids
+	accessLock sync.Mutex
+}
+
+func (s *Server) Settings() GameSettings {
+	s.settingsLock.RLock()
+	defer s.settingsLock.RUnlock()
+
+	return s.settings
+}
+
+// Update changes the settings and the update time
+func (s *Server) Update(change func(g *GameSettings)) {
+	s.settingsLock.Lock()
+	change(&s.settings)
+	s.settings.Updated = time.Now()
+	s.settingsLock.Unlock()
+}
+
+func (s *Server) Touch() {
+	s.Update(func(g *GameSettings) {})
+}
+
+// Expired checks if the server has not been updated within its TTL, a TTL of 0 never expires
+func (s *Server) Expired(now time.Time, ttl time.Duration, runningTTL time.Duration) bool {
+	g := s.Settings()
+	if g.Running {
+		ttl = runningTTL
+	}
+	return ttl > 0 && now.Sub(g.Updated) > ttl
+}
+
+// Join adds the player if the server is not full, returns false otherwise
+func (s *Server) Join(conn *net.TCPConn) bool {
+	g := s.Settings()
+
+	s.playersLock.Lock()
+	defer s.playersLock.Unlock()
+
+	if slices.Contains(s.players, conn) {
+		return true
+	}
+	if len(s.players)+int(g.AiPlayers) >= int(g.MaxPlayers) {
+		return false
+	}
+	s.players = append(s.players, conn)
+	return true
+}
+
+func (s *Server) AddPlayer(conn *net.TCPConn) {
+	s.playersLock.Lock()
+	if !slices.Contains(s.players, conn) {
+		s.players = append(s.players, conn)
+	}
+	s.playersLock.Unlock()
+}
+
+// RemovePlayer returns false if the player was not in the server
+func (s *Server) RemovePlayer(conn *net.TCPConn) bool {
+	s.playersLock.Lock()
+	defer s.playersLock.Unlock()
+
+	i := slices.Index(s.players, conn)
+	if i < 0 {
+		return false
+	}
+	s.players = slices.Delete(slices.Clone(s.players), i, i+1)
+	return true
+}
+
+func (s *Server) GetPlayerCount() int {
+	s.playersLock.Lock()
+	defer s.playersLock.Unlock()
+
+	return len(s.players)
+}
+
+// GetPlayers returns a copy of the player list
+func (s *Server) GetPlayers() []*net.TCPConn {
+	s.playersLock.Lock()
+	defer s.playersLock.Unlock()
+
+	return slices.Clone(s.players)
+}
+
+func (s *Server) IsFull() bool {
+	return s.FreeSlots() <= 0
+}
+
+// FreeSlots returns the number of slots neither taken by players nor the AI
+func (s *Server) FreeSlots() int {
+	g := s.Settings()
+	return int(g.MaxPlayers) - int(g.AiPlayers) - s.GetPlayerCount()
+}
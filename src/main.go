@@ -2,12 +2,26 @@ package main
 
 import (
 	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"s2dnglobby/accounts"
+	"s2dnglobby/bans"
+	"s2dnglobby/chatfilter"
+	"s2dnglobby/chatlog"
 	"s2dnglobby/config"
+	"s2dnglobby/events"
+	"s2dnglobby/history"
+	"s2dnglobby/ircbridge"
 	"s2dnglobby/library"
 	"s2dnglobby/lobby"
 	"s2dnglobby/netbridge"
 	"s2dnglobby/network"
+	"s2dnglobby/profiles"
+	"s2dnglobby/quarantine"
+	"s2dnglobby/webhooks"
 )
 
 var log = library.GetLogger("Main")
@@ -20,8 +34,47 @@ func main() {
 		return
 	}
 
-	netbridge.InitBridgeController()
-	lobby.InitLobby()
+	if err := config.LoadSettings(); err != nil {
+		log.Fatalln(err)
+		return
+	}
+	if err := accounts.InitAccounts(); err != nil {
+		log.Fatalln(err)
+		return
+	}
+	lob := lobby.New(lobby.LoadChatHistory())
+	go flushOnExit(lob)
+	bus := events.NewBus(config.Cfg.EventQueueSize)
+	events.LogEvents(bus)
+	events.InitEventAPI(bus)
+
+	if err := bans.InitBans(lob); err != nil {
+		log.Fatalln(err)
+		return
+	}
+	if err := history.InitHistory(); err != nil {
+		log.Fatalln(err)
+		return
+	}
+	history.Subscribe(bus)
+	if err := profiles.InitProfiles(); err != nil {
+		log.Fatalln(err)
+		return
+	}
+	profiles.Subscribe(bus)
+	if err := webhooks.InitWebhooks(bus); err != nil {
+		log.Fatalln(err)
+		return
+	}
+
+	netbridge.InitBridgeController(bus)
+	go lob.PrintStats(10 * time.Second)
+	network.InitNetwork(lob, bus)
+	ircbridge.InitIRCBridge(bus, network.RelayChat)
+	chatfilter.InitChatFilter(config.Cfg.ChatFilterFile)
+	chatlog.InitChatLog()
+	chatlog.Subscribe(bus)
+	quarantine.InitQuarantine()
 
 	var addr = net.TCPAddr{
 		IP: net.IPv4zero,
@@ -48,3 +101,15 @@ func main() {
 		go network.HandleConnection(conn)
 	}
 }
+
+// flushOnExit writes the files which are saved with a delay before the server stops
+func flushOnExit(lob *lobby.Lobby) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+
+	log.Infoln("Shutting down")
+	lob.ChatHistory().Flush()
+	profiles.Flush()
+	os.Exit(0)
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os/exec"
 	"s2dnglobby/config"
+	"s2dnglobby/events"
 	"s2dnglobby/library"
 	"strconv"
 	"strings"
@@ -19,6 +20,7 @@ const portStart = 10_000
 const portRange = 1000
 
 var portLock sync.Mutex
+var bus *events.Bus
 
 func requestAvailablePort(port int) (bool, error) {
 	ss := exec.Command("ss", "-tulpn")
@@ -114,9 +116,12 @@ func handleBridgePort(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, port)
 
 	log.Infoln("host port requested; found:", port)
+	bus.Publish(events.BridgePortAllocated{Time: time.Now(), Port: port, Remote: r.RemoteAddr})
 }
 
-func InitBridgeController() {
+func InitBridgeController(b *events.Bus) {
+	bus = b
+
 	// check if port forward is working
 	http.HandleFunc("/port/check", handleForwardCheck)
 
@@ -0,0 +1,187 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"s2dnglobby/bans"
+	"s2dnglobby/chatcmd"
+	"s2dnglobby/config"
+	"s2dnglobby/events"
+	"s2dnglobby/lobby"
+	"s2dnglobby/profiles"
+)
+
+var commands = chatcmd.NewRegistry()
+var startTime = time.Now()
+var lob *lobby.Lobby
+
+func InitNetwork(l *lobby.Lobby, b *events.Bus) {
+	lob = l
+	bus = b
+	startTime = time.Now()
+	bans.OnAdd = enforceBan
+
+	registerCommands()
+	registerWhisperCommands()
+	registerModCommands()
+	registerPrivateCommands()
+	registerHistoryCommands()
+	registerFriendCommands()
+	registerQueueCommands()
+
+	subscribeNotifier(bus)
+	subscribeMatchmaking(bus)
+	initExperimentAPI()
+	initQueueAPI()
+	startReaper()
+}
+
+// handleChatCommand runs the command, replies only go to the caller
+func handleChatCommand(conn *net.TCPConn, user *lobby.Account, txt string) {
+	log.Infoln("User", user.Name, "used chat command:", chatcmd.Prefix+chatcmd.Name(txt))
+
+	commands.Dispatch(user, txt, func(reply string) {
+		sendChatMessage(conn, reply, 0)
+	})
+}
+
+func registerCommands() {
+	commands.Register(&chatcmd.Command{
+		Name:    "help",
+		Aliases: []string{"?"},
+		Usage:   "[command]",
+		Help:    "list commands or show help for one",
+		Run:     cmdHelp,
+	})
+	commands.Register(&chatcmd.Command{
+		Name:    "who",
+		Aliases: []string{"online"},
+		Help:    "list online players",
+		Run:     cmdWho,
+	})
+	commands.Register(&chatcmd.Command{
+		Name:  "profile",
+		Usage: "[user]",
+		Help:  "show activity statistics of a player",
+		Run:   cmdProfile,
+	})
+	commands.Register(&chatcmd.Command{
+		Name: "games",
+		Help: "list open games",
+		Run:  cmdGames,
+	})
+	commands.Register(&chatcmd.Command{
+		Name: "ping",
+		Help: "check if the lobby server responds",
+		Run: func(ctx *chatcmd.Context) {
+			ctx.Reply("pong")
+		},
+	})
+	commands.Register(&chatcmd.Command{
+		Name: "uptime",
+		Help: "show how long the lobby server is running",
+		Run: func(ctx *chatcmd.Context) {
+			ctx.Replyf("lobby running for %s", time.Since(startTime).Truncate(time.Second))
+		},
+	})
+	commands.Register(&chatcmd.Command{
+		Name: "motd",
+		Help: "show the message of the day",
+		Run: func(ctx *chatcmd.Context) {
+			ctx.Reply(config.GetMOTD(ctx.User.Name))
+		},
+	})
+}
+
+func cmdHelp(ctx *chatcmd.Context) {
+	if len(ctx.Args) > 0 {
+		cmd, ok := commands.Get(ctx.Args[0])
+		if !ok || cmd.Role > chatcmd.RoleOf(ctx.User) {
+			ctx.Replyf("unknown command %s", ctx.Args[0])
+			return
+		}
+		ctx.Replyf("%s\n%s", cmd.UsageLine(), cmd.Help)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("available commands:")
+	for _, cmd := range commands.Available(chatcmd.RoleOf(ctx.User)) {
+		fmt.Fprintf(&b, "\n%s%s - %s", chatcmd.Prefix, cmd.Name, cmd.Help)
+	}
+	ctx.Reply(b.String())
+}
+
+func cmdWho(ctx *chatcmd.Context) {
+	var names []string
+	for _, a := range lob.Users() {
+		name := a.Name
+		if a.Moderator {
+			name += " (mod)"
+		}
+		if a.JoinedServer() != nil {
+			name += " [in game]"
+		} else if _, ok := lob.Queue().Get(a.Uid); ok {
+			name += " [queued]"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ctx.Replyf("%d players online: %s", len(names), strings.Join(names, ", "))
+}
+
+func cmdGames(ctx *chatcmd.Context) {
+	servers := lob.Servers()
+	if len(servers) == 0 {
+		ctx.Reply("no open games")
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d games:", len(servers))
+	for _, s := range servers {
+		g := s.Settings()
+		fmt.Fprintf(&b, "\n#%d %s (%d/%d) %s", s.Id, g.Name, s.GetPlayerCount(), g.MaxPlayers, g.Map)
+		if g.Running {
+			b.WriteString(" [running]")
+		}
+		if s.IsPrivate() {
+			b.WriteString(" [private]")
+		}
+	}
+	ctx.Reply(b.String())
+}
+
+func cmdProfile(ctx *chatcmd.Context) {
+	name := ctx.User.Name
+	if len(ctx.Args) > 0 {
+		name = ctx.Args[0]
+	}
+
+	p, ok := profiles.Get(name)
+	if !ok {
+		ctx.Replyf("no profile for %s", name)
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "profile of %s:", p.Name)
+	if p.Online {
+		b.WriteString(" (online)")
+	}
+	fmt.Fprintf(&b, "\nfirst seen %s, last seen %s", p.FirstSeen.Format("2006-01-02"), p.LastSeen.Format("2006-01-02 15:04"))
+	fmt.Fprintf(&b, "\nonline for %s in %d logins", p.OnlineTime().Truncate(time.Minute), p.Logins)
+	fmt.Fprintf(&b, "\ngames hosted: %d, joined: %d", p.GamesHosted, p.GamesJoined)
+	if maps := p.FavouriteMaps(3); len(maps) > 0 {
+		fmt.Fprintf(&b, "\nfavourite maps: %s", strings.Join(maps, ", "))
+	}
+	if h := p.UsualHour(); h >= 0 {
+		fmt.Fprintf(&b, "\nusually logs in around %02d:00 UTC", h)
+	}
+	ctx.Reply(b.String())
+}
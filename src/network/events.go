@@ -0,0 +1,84 @@
+package network
+
+import (
+	"fmt"
+
+	"s2dnglobby/config"
+	"s2dnglobby/events"
+	"s2dnglobby/lobby"
+	"s2dnglobby/packages"
+)
+
+/*
+* The handlers publish what happened in the lobby, side effects which do not
+* answer a request (login packets, chat notices) are done by the notifier subscriber.
+* Server list updates stay in the handlers because they carry the ticket id of the request.
+ */
+
+var bus *events.Bus
+
+func publish(e events.Event) {
+	bus.Publish(e)
+}
+
+// serverInfo takes a snapshot of the server for an event
+func serverInfo(server *lobby.Server) events.ServerInfo {
+	g := server.Settings()
+
+	return events.ServerInfo{
+		Id:         server.Id,
+		Name:       g.Name,
+		Host:       server.OwnerName,
+		OwnerId:    server.OwnerId,
+		Map:        g.Map,
+		MaxPlayers: g.MaxPlayers,
+		Players:    server.GetPlayerCount(),
+		AiPlayers:  g.AiPlayers,
+		GameMode:   g.GameMode,
+		Level:      g.Level,
+		Hardcore:   g.Hardcore,
+		Running:    g.Running,
+		Bridged:    server.Port != config.DefaultPort,
+		Private:    server.IsPrivate(),
+	}
+}
+
+func subscribeNotifier(b *events.Bus) {
+	b.Subscribe("notifier", func(e events.Event) {
+		switch e := e.(type) {
+		case events.UserLoggedIn:
+			p := packages.NewUserLoggedIn(e.Name, e.Uid)
+			announceLogin(e.Name, e.Guest, p, p.Type, true)
+
+		case events.UserLoggedOut:
+			p := packages.NewUserLoggedOut(e.Uid)
+			announceLogin(e.Name, e.Guest, p, p.Type, false)
+
+		case events.ServerCreated:
+			notifyFriends(e.Server.OwnerId, e.Server.Host, "<< your friend %s is hosting %s (%s) >>", e.Server.Host, e.Server.Name, e.Server.Map)
+
+		case events.PlayerJoined:
+			notifyHost(e.Server.Id, fmt.Sprintf("<< %s joined your game >>", e.Name))
+			if !e.Server.Private {
+				notifyFriends(e.Uid, e.Name, "<< your friend %s joined the game %s >>", e.Name, e.Server.Name)
+			}
+
+		case events.PlayerLeft:
+			notifyHost(e.Server.Id, fmt.Sprintf("<< %s left your game >>", e.Name))
+		}
+	})
+}
+
+// announceLogin sends the login or logout package to all observers, with a chat notice if wanted
+func announceLogin(name string, guest bool, pack any, pType uint16, loggedIn bool) {
+	for _, a := range lob.Users() {
+		if !a.Observes(lobby.ObsUserLogin) {
+			continue
+		}
+		go sendReply(a.Connection, pack, pType)
+
+		if msg := loginNotice(name, guest, a, loggedIn); msg != "" {
+			go sendChatMessage(a.Connection, msg, 0)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package network
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"s2dnglobby/config"
+	"s2dnglobby/library"
+	"s2dnglobby/lobby"
+	"s2dnglobby/packages"
+)
+
+/*
+* Experiment mode to find out which GameServerData entries the unpatched client
+* shows with its default filter (see FIXME in createGameServerData).
+* An admin sends a tester a set of synthetic servers, every combination of the given
+* parameters, labeled with the parameters. The tester reports which labels are visible.
+ */
+
+const experimentIdBase = 0xFFFF0000 // ServerIds of synthetic servers, far above real ones
+const maxExperimentVariants = 256
+
+type experimentRequest struct {
+	User        string
+	Versions    []string
+	ServerTypes []uint8
+	LobbyIds    []uint32
+	Data        []string // hex encoded
+}
+
+type experimentVariant struct {
+	ServerId   uint32
+	Label      string
+	Version    string
+	ServerType uint8
+	LobbyId    uint32
+	Data       string
+}
+
+type experimentResponse struct {
+	User      string
+	Observing bool // the tester has the server list open
+	Variants  []experimentVariant
+}
+
+// synthetic servers sent per user, to be able to remove them again
+var experiments = make(map[uint32][]uint32)
+var experimentsLock sync.Mutex
+
+func initExperimentAPI() {
+	// POST: send variants to a user, DELETE ?user=<name>: remove them again
+	http.HandleFunc("/api/admin/experiment", library.AdminOnly(handleExperiment))
+}
+
+func handleExperiment(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		req := new(experimentRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		user, ok := lob.GetUserByName(req.User)
+		if !ok {
+			http.Error(w, "user is not online", http.StatusNotFound)
+			return
+		}
+
+		variants, err := experimentVariants(req, user.Patchlevel)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		clearExperiment(user)
+		runExperiment(user, variants)
+
+		library.WriteJSONResponse(w, experimentResponse{
+			User:      user.Name,
+			Observing: user.Observes(lobby.ObsServerList),
+			Variants:  variants,
+		})
+
+	case http.MethodDelete:
+		user, ok := lob.GetUserByName(r.URL.Query().Get("user"))
+		if !ok {
+			http.Error(w, "user is not online", http.StatusNotFound)
+			return
+		}
+		clearExperiment(user)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// experimentVariants builds all combinations of the requested parameters,
+// missing parameters get a set of guesses
+func experimentVariants(req *experimentRequest, patchlevel uint32) ([]experimentVariant, error) {
+	versions := req.Versions
+	if len(versions) == 0 {
+		p := strconv.Itoa(int(patchlevel))
+		versions = []string{"", p, "Version " + p, "gb_" + p, "1." + p}
+	}
+	serverTypes := req.ServerTypes
+	if len(serverTypes) == 0 {
+		serverTypes = []uint8{0, 1, 2, 3}
+	}
+	lobbyIds := req.LobbyIds
+	if len(lobbyIds) == 0 {
+		lobbyIds = []uint32{0, 1}
+	}
+	data := req.Data
+	if len(data) == 0 {
+		data = []string{"", "00", "01000000"}
+	}
+
+	total := len(versions) * len(serverTypes) * len(lobbyIds) * len(data)
+	if total > maxExperimentVariants {
+		return nil, fmt.Errorf("too many variants: %d, at most %d allowed", total, maxExperimentVariants)
+	}
+
+	for _, d := range data {
+		if _, err := hex.DecodeString(d); err != nil {
+			return nil, fmt.Errorf("invalid data %s: %w", d, err)
+		}
+	}
+
+	var variants []experimentVariant
+	for _, v := range versions {
+		for _, t := range serverTypes {
+			for _, l := range lobbyIds {
+				for _, d := range data {
+					n := len(variants)
+					variants = append(variants, experimentVariant{
+						ServerId:   experimentIdBase + uint32(n),
+						Label:      fmt.Sprintf("X%d v=%q t=%d l=%d d=%s", n, v, t, l, d),
+						Version:    v,
+						ServerType: t,
+						LobbyId:    l,
+						Data:       d,
+					})
+				}
+			}
+		}
+	}
+	return variants, nil
+}
+
+func runExperiment(user *lobby.Account, variants []experimentVariant) {
+	log.Infoln("Sending", len(variants), "experiment servers to", user.Name)
+
+	ids := make([]uint32, 0, len(variants))
+
+	for _, v := range variants {
+		data, _ := hex.DecodeString(v.Data)
+
+		p := packages.NewGameServerData()
+		p.ServerId = v.ServerId
+		p.Name = v.Label
+		p.Description = v.Label
+		p.IP = "127.0.0.1"
+		p.Port = config.DefaultPort
+		p.ServerType = v.ServerType
+		p.LobbyId = v.LobbyId
+		p.Version = v.Version
+		p.MaxPlayers = 4
+		p.CurrPlayers = 1
+		p.Map = "experiment"
+		p.Data = data
+
+		sendReply(user.Connection, p, p.Type)
+		ids = append(ids, v.ServerId)
+	}
+
+	experimentsLock.Lock()
+	experiments[user.Uid] = ids
+	experimentsLock.Unlock()
+}
+
+// clearExperiment removes the synthetic servers of the last experiment from the client
+func clearExperiment(user *lobby.Account) {
+	experimentsLock.Lock()
+	ids := experiments[user.Uid]
+	delete(experiments, user.Uid)
+	experimentsLock.Unlock()
+
+	for _, id := range ids {
+		r := packages.NewRemoveServer(id, false, 0)
+		sendReply(user.Connection, r, r.Type)
+	}
+}
@@ -0,0 +1,121 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"s2dnglobby/accounts"
+	"s2dnglobby/chatcmd"
+	"s2dnglobby/config"
+	"s2dnglobby/lobby"
+)
+
+/*
+* Friends get a chat notice when a friend logs in, hosts or joins a game.
+* With LoginNotices set to "friends" only friends see logins and logouts in the chat.
+ */
+
+func registerFriendCommands() {
+	commands.Register(&chatcmd.Command{
+		Name:    "friend",
+		Usage:   "<add|remove> <user>",
+		Help:    "add or remove a friend, friends get notified about you",
+		MinArgs: 2,
+		Run:     cmdFriend,
+	})
+	commands.Register(&chatcmd.Command{
+		Name: "friends",
+		Help: "list your friends",
+		Run:  cmdFriends,
+	})
+}
+
+func cmdFriend(ctx *chatcmd.Context) {
+	if ctx.User.Guest {
+		ctx.Reply("guests cannot have friends")
+		return
+	}
+
+	name := ctx.Args[1]
+
+	switch ctx.Args[0] {
+	case "add":
+		if strings.EqualFold(name, ctx.User.Name) {
+			ctx.Reply("you cannot add yourself")
+			return
+		}
+		err := accounts.AddFriend(ctx.User.Name, name)
+		switch {
+		case errors.Is(err, accounts.ErrUnknownAccount):
+			ctx.Replyf("%s has never been online", name)
+		case err != nil:
+			ctx.Reply(err.Error())
+		default:
+			ctx.Replyf("added %s to your friends", name)
+		}
+
+	case "remove", "rm":
+		if accounts.RemoveFriend(ctx.User.Name, name) {
+			ctx.Replyf("removed %s from your friends", name)
+		} else {
+			ctx.Replyf("%s is not your friend", name)
+		}
+
+	default:
+		cmd, _ := commands.Get("friend")
+		ctx.Reply(cmd.UsageLine())
+	}
+}
+
+func cmdFriends(ctx *chatcmd.Context) {
+	list := accounts.Friends(ctx.User.Name)
+	if len(list) == 0 {
+		ctx.Reply("no friends yet, add them with /friend add <user>")
+		return
+	}
+
+	for i, name := range list {
+		if u, ok := lob.GetUserByName(name); ok {
+			list[i] = u.Name + " (online)"
+		}
+	}
+	ctx.Replyf("%d friends: %s", len(list), strings.Join(list, ", "))
+}
+
+// isFriendOf checks if the user is on the friends list of the other user
+func isFriendOf(name string, guest bool, other *lobby.Account) bool {
+	return !guest && !other.Guest && accounts.IsFriend(other.Name, name)
+}
+
+// notifyFriends sends a chat notice to all online users who have the user as friend
+func notifyFriends(uid uint32, name string, format string, v ...any) {
+	if accounts.IsGuestUid(uid) {
+		return
+	}
+	msg := fmt.Sprintf(format, v...)
+
+	for _, a := range lob.Users() {
+		if a.Uid != uid && isFriendOf(name, false, a) {
+			go sendChatMessage(a.Connection, msg, 0)
+		}
+	}
+}
+
+// loginNotice returns the chat notice the observer gets about a login or logout, empty for none
+func loginNotice(name string, guest bool, observer *lobby.Account, loggedIn bool) string {
+	friend := isFriendOf(name, guest, observer)
+	if !friend && config.Cfg.LoginNotices == config.LoginNoticesFriends {
+		return ""
+	}
+
+	switch {
+	case friend && loggedIn:
+		return fmt.Sprintf("<< your friend %s has logged in! >>", name)
+	case friend:
+		return fmt.Sprintf("<< your friend %s has logged out >>", name)
+	case loggedIn:
+		return fmt.Sprintf("<< %s has logged in! >>", name)
+	}
+	return fmt.Sprintf("<< %s has logged out >>", name)
+}
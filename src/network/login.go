@@ -0,0 +1,112 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"unicode"
+
+	"s2dnglobby/config"
+	"s2dnglobby/lobby"
+)
+
+const maxNameSuffix = 99
+
+// serializes the duplicate check and adding the user to the lobby
+var loginLock sync.Mutex
+
+// checkNickname returns an error if the name could be mistaken for system messages
+func checkNickname(name string) error {
+	if strings.HasPrefix(strings.TrimSpace(name), "<<") {
+		return fmt.Errorf("nickname looks like a system message")
+	}
+
+	key := alnumName(name)
+	if key == "" {
+		return fmt.Errorf("nickname is empty")
+	}
+
+	for _, r := range config.Cfg.ReservedNames {
+		if key == alnumName(r) {
+			return fmt.Errorf("nickname is reserved")
+		}
+	}
+
+	return nil
+}
+
+// alnumName reduces the name to lower case letters and digits,
+// so "[System]" and "S Y S T E M" are both caught
+func alnumName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// admitUser applies the duplicate login policy and adds the user to the lobby,
+// returns an error message for the client if the login got rejected.
+// A kicked session gets closed after the lock is released, so a slow socket
+// does not hold up other logins.
+func admitUser(user *lobby.Account) (string, bool) {
+	var kick *lobby.Account
+
+	loginLock.Lock()
+	existing, ok := lob.GetUserByName(user.Name)
+	if ok && existing.Connection != user.Connection {
+		switch policy := config.Cfg.DuplicateLogin; {
+		case policy == config.DuplicateKick:
+			kick = existing
+
+		// accounts keep their name, so they get rejected like with DuplicateReject
+		case policy == config.DuplicateSuffix && user.Guest:
+			name, ok := freeGuestName(user.Name)
+			if !ok {
+				loginLock.Unlock()
+				return "nickname already logged in", false
+			}
+			user.Name = name
+
+		default:
+			loginLock.Unlock()
+			return "nickname already logged in", false
+		}
+	}
+	lob.AddUser(user)
+	loginLock.Unlock()
+
+	if kick != nil {
+		kickUser(kick.Connection, "You logged in from another location")
+	}
+	return "", true
+}
+
+// nameTaken reports if admitUser would reject an account with the name
+func nameTaken(name string) bool {
+	_, ok := lob.GetUserByName(name)
+	return ok && config.Cfg.DuplicateLogin != config.DuplicateKick
+}
+
+func freeGuestName(name string) (string, bool) {
+	for i := 2; i <= maxNameSuffix; i++ {
+		n := fmt.Sprintf("%s(%d)", name, i)
+		if _, ok := lob.GetUserByName(n); !ok {
+			return n, true
+		}
+	}
+	return "", false
+}
+
+// kickUser tells the user why and closes the session
+func kickUser(conn *net.TCPConn, reason string) {
+	if user, ok := lob.GetUser(conn); ok {
+		log.Infoln("Kicking user", user.Name+":", reason)
+	}
+
+	sendChatMessage(conn, fmt.Sprintf("<< %s >>", reason), 0)
+	notifyUserLoggedOut(conn)
+}
@@ -0,0 +1,137 @@
+package network
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"s2dnglobby/bans"
+	"s2dnglobby/chatcmd"
+	"s2dnglobby/config"
+	"s2dnglobby/library"
+)
+
+// enforceBan kicks every logged in user affected by the new ban
+func enforceBan(b bans.Ban) {
+	for _, a := range lob.Users() {
+		if b.Matches(a.Name, library.RemoteIP(a.Connection), a.KeyHash) {
+			go kickUser(a.Connection, b.Message())
+		}
+	}
+}
+
+// isModerator is only true for verified accounts
+func isModerator(name string, guest bool) bool {
+	if guest || config.Cfg.AccountMode != config.AccountModeFile {
+		return false
+	}
+
+	key := library.NormalizeName(name)
+	for _, m := range config.Cfg.Moderators {
+		if library.NormalizeName(m) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func registerModCommands() {
+	commands.Register(&chatcmd.Command{
+		Name:    "ban",
+		Usage:   "<account|ip|cdkey> <user|value> [duration] [reason]",
+		Help:    "ban a user, or an account name, IP, CIDR range or hex CD key if no such user is online. Duration e.g. 2h or 7d, permanent if omitted",
+		Role:    chatcmd.RoleModerator,
+		MinArgs: 2,
+		Run:     cmdBan,
+	})
+	commands.Register(&chatcmd.Command{
+		Name:    "unban",
+		Usage:   "<id>",
+		Help:    "remove a ban",
+		Role:    chatcmd.RoleModerator,
+		MinArgs: 1,
+		Run:     cmdUnban,
+	})
+	commands.Register(&chatcmd.Command{
+		Name: "bans",
+		Help: "list active bans",
+		Role: chatcmd.RoleModerator,
+		Run:  cmdBans,
+	})
+}
+
+func cmdBan(ctx *chatcmd.Context) {
+	args := ctx.Args
+	kind := bans.Kind(args[0])
+	target := args[1]
+	args = args[2:]
+
+	duration := ""
+	if len(args) > 0 {
+		if _, err := bans.ParseDuration(args[0]); err == nil {
+			duration = args[0]
+			args = args[1:]
+		}
+	}
+
+	// online users get banned by their current values, everything else is taken as it is
+	value, user := target, ""
+	if _, ok := lob.GetUserByName(target); ok {
+		value, user = "", target
+	}
+
+	b, err := bans.FromRequest(kind, value, user, duration)
+	if err != nil {
+		ctx.Reply("ban failed: " + err.Error())
+		return
+	}
+	b.Reason = strings.Join(args, " ")
+	b.CreatedBy = ctx.User.Name
+
+	b, err = bans.Add(b)
+	if err != nil {
+		ctx.Reply("ban failed: " + err.Error())
+		return
+	}
+
+	ctx.Replyf("%s banned (ban #%d)", target, b.Id)
+}
+
+func cmdUnban(ctx *chatcmd.Context) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(ctx.Args[0], "#"), 10, 32)
+	if err != nil {
+		ctx.Reply("invalid ban id: " + ctx.Args[0])
+		return
+	}
+	if !bans.Remove(uint32(id)) {
+		ctx.Replyf("ban #%d not found", id)
+		return
+	}
+
+	ctx.Replyf("ban #%d removed", id)
+}
+
+func cmdBans(ctx *chatcmd.Context) {
+	list := bans.List()
+	if len(list) == 0 {
+		ctx.Reply("no active bans")
+		return
+	}
+
+	var b strings.Builder
+	for _, ban := range list {
+		value := ban.Value
+		if ban.Kind == bans.KindKey {
+			value = value[:8] + "..."
+		}
+		fmt.Fprintf(&b, "#%d %s %s", ban.Id, ban.Kind, value)
+		if !ban.Expires.IsZero() {
+			fmt.Fprintf(&b, " until %s", ban.Expires.UTC().Format("2006-01-02 15:04"))
+		}
+		if ban.Reason != "" {
+			fmt.Fprintf(&b, " (%s)", ban.Reason)
+		}
+		b.WriteString("\n")
+	}
+	ctx.Reply(strings.TrimSuffix(b.String(), "\n"))
+}
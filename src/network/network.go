@@ -11,10 +11,17 @@ import (
 	"strings"
 	"time"
 
+	"s2dnglobby/accounts"
+	"s2dnglobby/bans"
+	"s2dnglobby/chatcmd"
+	"s2dnglobby/chatfilter"
+	"s2dnglobby/chatlog"
 	"s2dnglobby/config"
+	"s2dnglobby/events"
 	"s2dnglobby/library"
 	"s2dnglobby/lobby"
 	"s2dnglobby/packages"
+	"s2dnglobby/quarantine"
 )
 
 var log = library.GetLogger("ConnHandler")
@@ -29,6 +36,15 @@ func HandleConnection(conn *net.TCPConn) {
 		return
 	}
 
+	// banned IPs only get the chance to log in, so the client can show the reason
+	_, ipBanned := bans.Check("", library.RemoteIP(conn), "")
+	if ipBanned {
+		log.Infoln("Connection from banned IP", conn.RemoteAddr().String())
+	}
+
+	// last messages of this session, used as context for quarantined messages
+	var recent []quarantine.Message
+
 	for {
 		header, err := getHeader(conn)
 		if err != nil {
@@ -61,7 +77,7 @@ func HandleConnection(conn *net.TCPConn) {
 
 		//log.Debugln(hex.EncodeToString(payload))
 
-		payloadBuf := bytes.NewBuffer(payload)
+		payloadBuf := &packetBuffer{Buffer: bytes.NewBuffer(payload)}
 		msgHeader := new(packages.MsgHeader)
 
 		if err := binary.Read(payloadBuf, binary.LittleEndian, msgHeader); err != nil {
@@ -73,6 +89,11 @@ func HandleConnection(conn *net.TCPConn) {
 			continue
 		}
 
+		if ipBanned && msgHeader.Type != 4 && msgHeader.Type != 71 {
+			log.Errorln("Dropping message", msgHeader.Type, "from banned IP")
+			continue
+		}
+
 		switch msgHeader.Type {
 		case 2:
 			handleChatMessage(conn, payloadBuf)
@@ -107,10 +128,59 @@ func HandleConnection(conn *net.TCPConn) {
 		default:
 			log.Errorln("Unknown MsgType:", msgHeader.Type)
 			log.Debugln(hex.EncodeToString(payloadBuf.Bytes()))
+
+			quarantineMessage(conn, msgHeader.Type, payload[4:], nil, recent)
+		}
+
+		if payloadBuf.decodeErr != nil {
+			quarantineMessage(conn, msgHeader.Type, payload[4:], payloadBuf.decodeErr, recent)
+		}
+
+		recent = append(recent, quarantine.NewMessage(msgHeader.Type, payload[4:]))
+		if len(recent) > config.QuarantineContextSize {
+			recent = recent[1:]
 		}
 	}
 }
 
+// packetBuffer remembers if a handler failed to parse the payload
+type packetBuffer struct {
+	*bytes.Buffer
+	decodeErr error
+}
+
+func quarantineMessage(conn *net.TCPConn, msgType uint16, payload []byte, decodeErr error, recent []quarantine.Message) {
+	entry := &quarantine.Entry{
+		Remote:    conn.RemoteAddr().String(),
+		MsgType:   msgType,
+		Partial:   decodeErr != nil,
+		Payload:   hex.EncodeToString(payload),
+		Preceding: append([]quarantine.Message(nil), recent...),
+	}
+	if decodeErr != nil {
+		entry.Error = decodeErr.Error()
+	}
+
+	if user, ok := lob.GetUser(conn); ok {
+		entry.User = quarantine.UserState{
+			LoggedIn:      true,
+			Name:          user.Name,
+			Uid:           user.Uid,
+			ObsUserLogin:  user.Observes(lobby.ObsUserLogin),
+			ObsGlobalChat: user.Observes(lobby.ObsGlobalChat),
+			ObsServerList: user.Observes(lobby.ObsServerList),
+		}
+		if server, ok := lob.GetServer(conn); ok {
+			entry.User.OwnsServer = server.Id
+		}
+		if joined := user.JoinedServer(); joined != nil {
+			entry.User.JoinedServer = joined.Id
+		}
+	}
+
+	go quarantine.Add(entry)
+}
+
 func getHeader(conn *net.TCPConn) (*packages.Header, error) {
 	var header = new(packages.Header)
 	var payload = make([]byte, 28)
@@ -196,50 +266,87 @@ func sendReply(conn *net.TCPConn, pack any, pType uint16) {
 /* NOTIFY FUNCTIONS */
 
 func notifyUserLoggedIn(user *lobby.Account) {
-	for c, a := range lobby.GetAllUsers() {
-		if a.ObsUserLogin {
-			p := packages.NewUserLoggedIn(user.Name, user.Uid)
-			msg := fmt.Sprintf("<< %s has logged in! >>", user.Name)
-
-			go sendReply(c, p, p.Type)
-			go sendChatMessage(c, msg, 0)
-		}
-	}
+	publish(events.UserLoggedIn{
+		Time: time.Now(),
+		Name: user.Name,
+		Uid: user.Uid,
+		Guest: user.Guest,
+		Patchlevel: user.Patchlevel,
+	})
 
 	log.Infoln("User", user.Name, "logged in")
 }
 
 func notifyUserLoggedOut(conn *net.TCPConn) {
-	user, ok := lobby.GetUser(conn)
+	user, ok := lob.GetUser(conn)
 	if !ok {
 		log.Errorln("Failed to fetch user from list")
 		return
 	}
 
-	lobby.RemoveUser(conn)
+	lob.RemoveUser(conn)
+	chatfilter.Forget(chatSender(user))
+	leaveGameServer(conn, user)
+	leaveStartedGames(conn, user)
 	// just in case user has created a server
-	lobby.RemoveServer(conn)
+	removeGameServer(conn, 0, "host disconnected")
 
-	for c, a := range lobby.GetAllUsers() {
-		if a.ObsUserLogin {
-			p := packages.NewUserLoggedOut(user.Uid)
-			msg := fmt.Sprintf("<< %s has logged out >>", user.Name)
-
-			go sendReply(c, p, p.Type)
-			go sendChatMessage(c, msg, 0)
-		}
-	}
+	publish(events.UserLoggedOut{
+		Time: time.Now(),
+		Name: user.Name,
+		Uid: user.Uid,
+		Guest: user.Guest,
+	})
 
 	log.Infoln("User", user.Name, "disconnected from server")
 	conn.Close()
 }
 
+// notifyGameServerUpdate sends the server to all observers whose filter matches,
+// observers which do not match anymore get a RemoveServer
 func notifyGameServerUpdate(server *lobby.Server, ticketId uint32) {
-	p := createGameServerData(server, ticketId)
+	r := packages.NewRemoveServer(server.Id, server.Settings().Running, ticketId)
 
-	for c, a := range lobby.GetAllUsers() {
-		if a.ObsServerList {
-			go sendReply(c, p, p.Type)
+	for _, a := range lob.Users() {
+		if !a.Observes(lobby.ObsServerList) {
+			continue
+		}
+
+		if canSeeServer(a, server) {
+			a.SetVisible(server.Id, true)
+			p := createGameServerData(server, a, ticketId)
+			go sendReply(a.Connection, p, p.Type)
+		} else if a.SetVisible(server.Id, false) {
+			go sendReply(a.Connection, r, r.Type)
+		}
+	}
+}
+
+// canSeeServer checks the observer filter and the version compatibility
+func canSeeServer(user *lobby.Account, server *lobby.Server) bool {
+	filter := user.ServerFilter()
+	return filter.Matches(server) && config.Compatible(user.Patchlevel, server.Patchlevel)
+}
+
+// removeGameServer removes the server of the connection, observers always get notified
+func removeGameServer(conn *net.TCPConn, ticketId uint32, reason string) {
+	server, ok := lob.RemoveServer(conn)
+	if !ok {
+		return
+	}
+
+	notifyGameServerRemoved(server, ticketId, reason)
+}
+
+// notifyGameServerRemoved sends a RemoveServer to all observers which know the server
+func notifyGameServerRemoved(server *lobby.Server, ticketId uint32, reason string) {
+	publish(events.ServerRemoved{Time: time.Now(), Server: serverInfo(server), Reason: reason})
+
+	r := packages.NewRemoveServer(server.Id, server.Settings().Running, ticketId)
+
+	for _, a := range lob.Users() {
+		if a.SetVisible(server.Id, false) && a.Observes(lobby.ObsServerList) {
+			go sendReply(a.Connection, r, r.Type)
 		}
 	}
 }
@@ -249,6 +356,9 @@ func notifyGameServerUpdate(server *lobby.Server, ticketId uint32) {
 func handlePackage[T any](r io.Reader) (*T, error) {
 	pack := new(T)
 	if err := packages.Deserialize(r, pack); err != nil {
+		if pb, ok := r.(*packetBuffer); ok {
+			pb.decodeErr = err
+		}
 		return nil, fmt.Errorf("failed to parse %T: %v", pack, err)
 	}
 
@@ -326,20 +436,69 @@ func handleRequestCreateAccount(conn *net.TCPConn, r io.Reader) {
 	* 0x3E: wrong version
 	*/
 
-	if pack.Patchlevel != config.Patchlevel {
-		sendResult(conn, 0x3E, "wrong patchlevel", pack.TicketId)
+	if !config.AcceptsPatchlevel(pack.Patchlevel) {
+		log.Infoln("Rejected patchlevel", pack.Patchlevel, "of", pack.Nickname)
+		sendResult(conn, 0x3E, config.PatchlevelMessage(pack.Patchlevel), pack.TicketId)
 		return
 	}
 	
-	// TODO CD key check (?)
+	if err := checkNickname(pack.Nickname); err != nil {
+		log.Infoln("Rejected nickname", pack.Nickname+":", err)
+		sendResult(conn, 0x29, err.Error(), pack.TicketId)
+		return
+	}
 
-	// we just accept everything, because we don't have a user database
+	if ban, ok := bans.Check(pack.Nickname, library.RemoteIP(conn), accounts.HashKey(pack.Cdkey)); ok {
+		log.Infoln("Rejected banned user", pack.Nickname, "ban", ban.Id)
+		sendResult(conn, 0x29, ban.Message(), pack.TicketId)
+		return
+	}
+
+	if err := accounts.ValidateKey(pack.Cdkey, pack.Keypool); err != nil {
+		log.Infoln("Rejected CD key of", pack.Nickname+":", err)
+		sendResult(conn, 0x1A, err.Error(), pack.TicketId)
+		return
+	}
+
+	// checked before the account gets created, admitUser would reject it afterwards
+	if nameTaken(pack.Nickname) {
+		log.Infoln("Rejected account", pack.Nickname+": already logged in")
+		sendResult(conn, 0x29, "nickname already logged in", pack.TicketId)
+		return
+	}
+
+	claim, err := accounts.ReserveKey(pack.Cdkey, pack.Nickname)
+	if err != nil {
+		log.Infoln("Rejected CD key of", pack.Nickname+":", err)
+		sendResult(conn, 0x1A, err.Error(), pack.TicketId)
+		return
+	}
+	defer claim.Release()
+
+	identity, err := accounts.Register(pack.Nickname, pack.Password)
+	switch {
+	case errors.Is(err, accounts.ErrUserExists):
+		sendResult(conn, 0x29, "user already exists", pack.TicketId)
+		return
+	case err != nil:
+		log.Errorln("Failed to create account:", err)
+		sendResult(conn, 1, "failed to create account", pack.TicketId)
+		return
+	}
 
 	user := &lobby.Account{
-		Name: pack.Nickname,
+		Name: identity.Name,
+		Uid: identity.Uid,
+		Moderator: isModerator(identity.Name, false),
+		KeyHash: accounts.HashKey(pack.Cdkey),
+		Patchlevel: pack.Patchlevel,
 		Connection: conn,
 	}
-	lobby.AddUser(user)
+	if msg, ok := admitUser(user); !ok {
+		sendResult(conn, 0x29, msg, pack.TicketId)
+		return
+	}
+	claim.Bind()
 
 	sendResult(conn, 0, "", pack.TicketId)
 	notifyUserLoggedIn(user)
@@ -360,19 +519,65 @@ func handleRequestLogin(conn *net.TCPConn, r io.Reader) {
 	* 0x3E: wrong version
 	*/
 
-	if pack.Patchlevel != config.Patchlevel {
-		sendResult(conn, 0x3E, "Patchlevel does not match", pack.TicketId)
+	if !config.AcceptsPatchlevel(pack.Patchlevel) {
+		log.Infoln("Rejected patchlevel", pack.Patchlevel, "of", pack.Nickname)
+		sendResult(conn, 0x3E, config.PatchlevelMessage(pack.Patchlevel), pack.TicketId)
 		return
 	}
 
-	// TODO CD Key check (?)
-	// TODO password check
+	if err := checkNickname(pack.Nickname); err != nil {
+		log.Infoln("Rejected nickname", pack.Nickname+":", err)
+		sendResult(conn, 0x3D, err.Error(), pack.TicketId)
+		return
+	}
+
+	if ban, ok := bans.Check(pack.Nickname, library.RemoteIP(conn), accounts.HashKey(pack.Cdkey)); ok {
+		log.Infoln("Rejected banned user", pack.Nickname, "ban", ban.Id)
+		sendResult(conn, 0x3D, ban.Message(), pack.TicketId)
+		return
+	}
+
+	if err := accounts.ValidateKey(pack.Cdkey, pack.Keypool); err != nil {
+		log.Infoln("Rejected CD key of", pack.Nickname+":", err)
+		sendResult(conn, 0x1B, err.Error(), pack.TicketId)
+		return
+	}
+
+	claim, err := accounts.ReserveKey(pack.Cdkey, pack.Nickname)
+	if err != nil {
+		log.Infoln("Rejected CD key of", pack.Nickname+":", err)
+		sendResult(conn, 0x1B, err.Error(), pack.TicketId)
+		return
+	}
+	defer claim.Release()
+
+	identity, err := accounts.Login(pack.Nickname, pack.Password)
+	if err != nil {
+		if !errors.Is(err, accounts.ErrAuthFailed) {
+			log.Errorln("Failed to check credentials:", err)
+		}
+		log.Infoln("Login of", pack.Nickname, "failed")
+		sendResult(conn, 0x3D, "auth failed", pack.TicketId)
+		return
+	}
 
 	user := &lobby.Account{
-		Name: pack.Nickname,
+		Name: identity.Name,
+		Uid: identity.Uid,
+		Guest: identity.Guest,
+		Moderator: isModerator(identity.Name, identity.Guest),
+		KeyHash: accounts.HashKey(pack.Cdkey),
+		Patchlevel: pack.Patchlevel,
 		Connection: conn,
 	}
-	lobby.AddUser(user)
+	if msg, ok := admitUser(user); !ok {
+		sendResult(conn, 0x3D, msg, pack.TicketId)
+		return
+	}
+	// guests do not use up the key
+	if !identity.Guest {
+		claim.Bind()
+	}
 
 	sendResult(conn, 0, "", pack.TicketId)
 	notifyUserLoggedIn(user)
@@ -385,7 +590,7 @@ func handleRequestMOTD(conn *net.TCPConn, r io.Reader) {
 		return
 	}
 
-	user, ok := lobby.GetUser(conn)
+	user, ok := lob.GetUser(conn)
 	if !ok {
 		log.Errorln("Failed to fetch user")
 		return
@@ -402,14 +607,15 @@ func handleRegObsGlobalChat(conn *net.TCPConn, r io.Reader) {
 		return
 	}
 
-	user, ok := lobby.GetUser(conn)
+	user, ok := lob.GetUser(conn)
 	if !ok {
 		log.Errorln("Failed to fetch user")
 		return
 	}
-	user.ObsGlobalChat = true
+	user.SetObserver(lobby.ObsGlobalChat, true)
 
 	sendResult(conn, 0, "", pack.TicketId)
+	sendChatHistory(conn, user.ChatLeftAt)
 
 	log.Infoln("User", user.Name, "registered to global chat")
 }
@@ -421,17 +627,28 @@ func handleRegObsServerList(conn *net.TCPConn, r io.Reader) {
 		return
 	}
 
-	user, ok := lobby.GetUser(conn)
+	user, ok := lob.GetUser(conn)
 	if !ok {
 		log.Errorln("Failed to fetch user")
 		sendResult(conn, 0x3, "Cannot get user list", pack.TicketId)
 		return
 	}
-	user.ObsServerList = true
+	user.ObserveServerList(lobby.ServerFilter{
+		ServerType: pack.ServerType,
+		RoomId: pack.RoomId,
+		Selection: pack.Selection,
+	})
+
+	if pack.SendAll {
+		for _, s := range lob.Servers() {
+			if !canSeeServer(user, s) {
+				continue
+			}
+			user.SetVisible(s.Id, true)
 
-	for _, s := range lobby.GetAllServers() {
-		p := createGameServerData(s, pack.TicketId)
-		sendReply(conn, p, p.Type)
+			p := createGameServerData(s, user, pack.TicketId)
+			sendReply(conn, p, p.Type)
+		}
 	}
 
 	sendResult(conn, 0, "", pack.TicketId)
@@ -444,17 +661,17 @@ func handleRegObsUserLogin(conn *net.TCPConn, r io.Reader) {
 		return
 	}
 
-	user, ok := lobby.GetUser(conn)
+	user, ok := lob.GetUser(conn)
 	if !ok {
 		log.Errorln("Failed to fetch user")
 		return
 	}
-	user.ObsUserLogin = true
+	user.SetObserver(lobby.ObsUserLogin, true)
 
 	sendResult(conn, 0, "", pack.TicketId)
 
-	for _, a := range lobby.GetAllUsers() {
-		if a.ObsUserLogin {
+	for _, a := range lob.Users() {
+		if a.Observes(lobby.ObsUserLogin) {
 			p := packages.NewUserLoggedIn(a.Name, a.Uid)
 			sendReply(conn, p, p.Type)
 		}
@@ -472,12 +689,13 @@ func handleDeregObsGlobalChat(conn *net.TCPConn, r io.Reader) {
 		return
 	}
 
-	user, ok := lobby.GetUser(conn)
+	user, ok := lob.GetUser(conn)
 	if !ok {
 		log.Errorln("Failed to fetch user")
 		return
 	}
-	user.ObsGlobalChat = false
+	user.SetObserver(lobby.ObsGlobalChat, false)
+	user.ChatLeftAt = time.Now()
 
 	sendResult(conn, 0, "", pack.TicketId)
 
@@ -491,12 +709,12 @@ func handleDeregObsUserLogin(conn *net.TCPConn, r io.Reader) {
 		return
 	}
 
-	user, ok := lobby.GetUser(conn)
+	user, ok := lob.GetUser(conn)
 	if !ok {
 		log.Errorln("Failed to fetch user")
 		return
 	}
-	user.ObsUserLogin = false
+	user.SetObserver(lobby.ObsUserLogin, false)
 
 	sendResult(conn, 0, "", pack.TicketId)
 }
@@ -508,12 +726,12 @@ func handleDeregObsServerList(conn *net.TCPConn, r io.Reader) {
 		return
 	}
 
-	user, ok := lobby.GetUser(conn)
+	user, ok := lob.GetUser(conn)
 	if !ok {
 		log.Errorln("Failed to fetch user")
 		return
 	}
-	user.ObsServerList = false
+	user.StopServerList()
 
 	sendResult(conn, 0, "", pack.TicketId)
 }
@@ -525,18 +743,130 @@ func handleChatMessage(conn *net.TCPConn, r io.Reader) {
 		return
 	}
 
-	// TODO chat commands
-	// TODO chat filter
-
-	user, ok := lobby.GetUser(conn)
+	user, ok := lob.GetUser(conn)
 	if !ok {
 		log.Errorln("Failed to fetch user")
 		return
 	}
 
-	for c, a := range lobby.GetAllUsers() {
-		if a.ObsGlobalChat {
-			go sendChatMessage(c, pack.Txt, user.Uid)
+	if isWhisperMode(pack.Mode) {
+		handleWhisperMessage(user, pack.Txt)
+		return
+	}
+	if pack.Mode != 0 {
+		log.Infoln("Got ChatMessage with unknown Mode:", pack.Mode)
+	}
+
+	if chatcmd.IsCommand(pack.Txt) {
+		handleChatCommand(conn, user, pack.Txt)
+		return
+	}
+	txt, ok := filterChat(user, chatcmd.Unescape(pack.Txt))
+	if !ok {
+		return
+	}
+
+	publish(events.ChatPosted{
+		Time: time.Now(),
+		FromId: user.Uid,
+		FromName: user.Name,
+		Mode: chatlog.ModeGlobal,
+		Txt: txt,
+	})
+	lob.ChatHistory().Add(lobby.ChatEntry{
+		Time: time.Now(),
+		FromId: user.Uid,
+		FromName: user.Name,
+		Txt: txt,
+	})
+
+	for _, a := range lob.Users() {
+		if a.Observes(lobby.ObsGlobalChat) {
+			go sendChatMessage(a.Connection, txt, user.Uid)
+		}
+	}
+}
+
+// chatSender identifies the user for the chat filter. Guests get a new uid on
+// every login, so they are tracked by IP to keep a mute across reconnects.
+func chatSender(user *lobby.Account) string {
+	if user.Guest {
+		return "ip:" + library.RemoteIP(user.Connection)
+	}
+	return fmt.Sprint("uid:", user.Uid)
+}
+
+// filterChat runs the message through the chat filter,
+// returns false if the message must not be sent
+func filterChat(user *lobby.Account, txt string) (string, bool) {
+	if user.Moderator {
+		return txt, true
+	}
+
+	v := chatfilter.Check(chatSender(user), txt)
+
+	switch v.Action {
+	case chatfilter.ActionDrop, chatfilter.ActionMute:
+		log.Infoln("Chat filter dropped message of", user.Name+":", v.Reason)
+		sendChatMessage(user.Connection, fmt.Sprintf("<< %s >>", v.Reason), 0)
+		return "", false
+	case chatfilter.ActionCensor:
+		log.Debugln("Chat filter censored message of", user.Name)
+	}
+
+	return v.Text, true
+}
+
+// sendChatHistory replays the global chat the user missed since the given time,
+// as system messages because the senders may not be online anymore
+func sendChatHistory(conn *net.TCPConn, since time.Time) {
+	entries := lob.ChatHistory().Get(config.Cfg.ChatHistoryReplay, since)
+	if len(entries) == 0 {
+		return
+	}
+
+	if config.Cfg.ChatHistoryMarker {
+		sendChatMessage(conn, "<< recent chat >>", 0)
+	}
+	for _, e := range entries {
+		msg := fmt.Sprintf("[%s] %s: %s", e.Time.UTC().Format("15:04"), e.FromName, e.Txt)
+		sendChatMessage(conn, msg, 0)
+	}
+	if config.Cfg.ChatHistoryMarker {
+		sendChatMessage(conn, "<< end of recent chat >>", 0)
+	}
+}
+
+// RelayChat shows a chat line from outside the lobby (e.g. IRC) to all chat observers,
+// the name is part of the text because the client only knows the names of online users.
+// The sender identifies the author outside the lobby for the chat filter.
+func RelayChat(sender string, name string, txt string, fromId uint32) {
+	v := chatfilter.Check(sender, txt)
+	switch v.Action {
+	case chatfilter.ActionDrop, chatfilter.ActionMute:
+		log.Infoln("Chat filter dropped relayed message of", name+":", v.Reason)
+		return
+	}
+	txt = v.Text
+
+	publish(events.ChatPosted{
+		Time: time.Now(),
+		FromId: fromId,
+		FromName: name,
+		Mode: chatlog.ModeRelay,
+		Txt: txt,
+	})
+	lob.ChatHistory().Add(lobby.ChatEntry{
+		Time: time.Now(),
+		FromId: fromId,
+		FromName: name,
+		Txt: txt,
+	})
+
+	msg := fmt.Sprintf("%s: %s", name, txt)
+	for _, a := range lob.Users() {
+		if a.Observes(lobby.ObsGlobalChat) {
+			go sendChatMessage(a.Connection, msg, fromId)
 		}
 	}
 }
@@ -553,7 +883,7 @@ func handleAddGameServer(conn *net.TCPConn, r io.Reader) {
 		return
 	}
 
-	user, ok := lobby.GetUser(conn)
+	user, ok := lob.GetUser(conn)
 	if !ok {
 		log.Errorln("Failed to fetch user")
 		return
@@ -582,62 +912,74 @@ func handleAddGameServer(conn *net.TCPConn, r io.Reader) {
 	}
 
 	server := &lobby.Server{
-		Name: pack.Name,
+		Host: conn,
 		OwnerId: user.Uid,
-		Description: pack.Description,
+		OwnerName: user.Name,
 		IP: ip,
 		Port: pack.Port,
 		ServerType: pack.ServerType,
 		LobbyId: pack.LobbyId,
 		Version: pack.Version,
-		MaxPlayers: pack.MaxPlayers,
-		AiPlayers: pack.AiPlayers,
-		Level: pack.Level,
-		GameMode: pack.GameMode,
-		Hardcore: pack.Hardcore,
-		Map: pack.Map,
 		AutomaticJoin: pack.AutomaticJoin,
-		Running: false,
-		Data: pack.Data,
-	}
+		Patchlevel: user.Patchlevel,
+	}
+	server.Update(func(g *lobby.GameSettings) {
+		g.Name = pack.Name
+		g.Description = pack.Description
+		g.MaxPlayers = pack.MaxPlayers
+		g.AiPlayers = pack.AiPlayers
+		g.Level = pack.Level
+		g.GameMode = pack.GameMode
+		g.Hardcore = pack.Hardcore
+		g.Map = pack.Map
+		g.Running = false
+		g.Data = pack.Data
+	})
+	leaveStartedGames(conn, user)
 	server.AddPlayer(conn)
-	lobby.AddServer(conn, server)
+	if old, ok := lob.AddServer(server); ok {
+		log.Infoln("User", user.Name, "replaced server", old.Settings().Name)
+		notifyGameServerRemoved(old, pack.TicketId, "replaced")
+	}
 
 	p := packages.NewResultId(0, "", server.Id, pack.TicketId)
 	sendReply(conn, p, p.Type)
 
+	publish(events.ServerCreated{Time: time.Now(), Server: serverInfo(server)})
+
 	notifyGameServerUpdate(server, pack.TicketId)
 
 	log.Infoln("User", user.Name, "created a new lobby as", pack.Name)
 }
 
-func createGameServerData(server *lobby.Server, ticketId uint32) *packages.GameServerData {
+// createGameServerData builds the server entry as seen by the viewer
+func createGameServerData(server *lobby.Server, viewer *lobby.Account, ticketId uint32) *packages.GameServerData {
 	// FIXME there is an issue with server entries being listed under "other versions"
 
-	v := server.Version // always empty (?)
-	//v := "11757" // does not work
-	//v := "Version 11757"
-	//v := "gb_11757"
-	
+	// server.Version is always empty (?), VersionStrings can override it per client version
+	// tried without success: "11757", "Version 11757", "gb_11757"
+	v := config.VersionString(viewer.Patchlevel, server.Version)
+	g := server.Settings()
+
 	p := packages.NewGameServerData()
 	p.ServerId = server.Id
-	p.Name = server.Name
+	p.Name = g.Name
 	p.OwnerId = server.OwnerId
-	p.Description = server.Description
+	p.Description = g.Description
 	p.IP = server.IP
 	p.Port = server.Port
 	p.ServerType = server.ServerType
 	p.LobbyId = server.LobbyId
 	p.Version = v
-	p.MaxPlayers = server.MaxPlayers
+	p.MaxPlayers = g.MaxPlayers
 	p.CurrPlayers = uint8(server.GetPlayerCount())
-	p.AiPlayers = server.AiPlayers
-	p.Level = server.Level
-	p.GameMode = server.GameMode
-	p.Hardcore = server.Hardcore
-	p.Map = server.Map
-	p.Running = server.Running
-	p.Data = server.Data
+	p.AiPlayers = g.AiPlayers
+	p.Level = g.Level
+	p.GameMode = g.GameMode
+	p.Hardcore = g.Hardcore
+	p.Map = g.Map
+	p.Running = g.Running
+	p.Data = g.Data
 	p.TicketId = ticketId
 
 	return p
@@ -656,7 +998,7 @@ func handleRemoveServer(conn *net.TCPConn, r io.Reader) {
 	* 0xE (14): StartGameServer 
 	*/
 
-	server, ok := lobby.GetServer(conn)
+	server, ok := lob.GetServer(conn)
 
 	switch tid := pack.TicketId; tid {
 	case 0xB:
@@ -682,10 +1024,18 @@ func handleRemoveServer(conn *net.TCPConn, r io.Reader) {
 			sendResult(conn, 1, "Invalid ServerID", tid)
 			return
 		}
-		server.Running = pack.Running
+		server.Update(func(g *lobby.GameSettings) {
+			g.Running = pack.Running
+		})
+		trackStartedGame(server)
+		publish(events.ServerStarted{Time: time.Now(), Server: serverInfo(server), Players: playerNames(server)})
 
 		for _, c := range server.GetPlayers() {
-			p := createGameServerData(server, tid)
+			player, ok := lob.GetUser(c)
+			if !ok {
+				continue
+			}
+			p := createGameServerData(server, player, tid)
 			go sendReply(c, p, p.Type)
 		}
 
@@ -693,13 +1043,11 @@ func handleRemoveServer(conn *net.TCPConn, r io.Reader) {
 		log.Errorln("Unknown RemoveServer ticketID:", pack.TicketId)
 	}
 
-	lobby.RemoveServer(conn)
-
-	for c, a := range lobby.GetAllUsers() {
-		if a.ObsServerList {
-			go sendReply(c, pack, pack.Type)
-		}
+	reason := "removed by host"
+	if pack.TicketId == 0xE {
+		reason = "started"
 	}
+	removeGameServer(conn, pack.TicketId, reason)
 
 	sendResult(conn, 0, "", pack.TicketId)
 }
@@ -711,31 +1059,35 @@ func handleChangeGameServer(conn *net.TCPConn, r io.Reader) {
 		return
 	}
 
-	server, ok := lobby.GetServer(conn)
+	server, ok := lob.GetServer(conn)
 	if !ok || server.Id != pack.ServerId {
-		log.Errorln("ServerID problem:", server.Id, pack.ServerId)
+		log.Errorln("ServerID problem:", pack.ServerId)
 		sendResult(conn, 3, "No server", pack.TicketId)
 		return
 	}
 
-	server.Name = pack.Name
-	server.Description = pack.Description
-	//server.MaxPlayers = pack.MaxPlayers - pack.SlotsOccupied
-	//server.AiPlayers = 
-	server.MaxPlayers = pack.MaxPlayers
-	server.AiPlayers = pack.SlotsOccupied
-	server.Level = pack.Level
-	server.GameMode = pack.GameMode
-	server.Hardcore = pack.Hardcore
-	server.Map = pack.Map
-	server.Running = pack.Running
-	server.Data = pack.Data
-	server.PropertyMask = pack.PropertyMask
+	server.Update(func(g *lobby.GameSettings) {
+		g.Name = pack.Name
+		g.Description = pack.Description
+		//g.MaxPlayers = pack.MaxPlayers - pack.SlotsOccupied
+		//g.AiPlayers = 
+		g.MaxPlayers = pack.MaxPlayers
+		g.AiPlayers = pack.SlotsOccupied
+		g.Level = pack.Level
+		g.GameMode = pack.GameMode
+		g.Hardcore = pack.Hardcore
+		g.Map = pack.Map
+		g.Running = pack.Running
+		g.Data = pack.Data
+		g.PropertyMask = pack.PropertyMask
+	})
 
 	notifyGameServerUpdate(server, pack.TicketId)
 	sendResult(conn, 0, "", pack.TicketId)
 
-	log.Infoln("Server", server.Name, "got updated")
+	publish(events.ServerChanged{Time: time.Now(), Server: serverInfo(server)})
+
+	log.Infoln("Server", pack.Name, "got updated")
 }
 
 func handleJoinServer(conn *net.TCPConn, r io.Reader) {
@@ -749,33 +1101,56 @@ func handleJoinServer(conn *net.TCPConn, r io.Reader) {
 	* Error codes:
 	* 0x84 (132): GameServer not found
 	* 0x87 (135): GameServer full
+	* private games reply "not found" as well, the client has no code for it
 	*/
 
-	server, ok := lobby.GetServerById(pack.ServerId)
+	server, ok := lob.GetServerById(pack.ServerId)
 	if !ok {
 		log.Errorln("Tried to join ServerId that does not exist")
 		sendResult(conn, 0x84, "game server not found", pack.TicketId)
 		return
 	}
 
-	if server.IsFull() {
-		log.Infoln("Lobby", server.Name, "is already full")
-		sendResult(conn, 0x87, "game server full", pack.TicketId)
+	user, ok := lob.GetUser(conn)
+	if !ok {
+		log.Errorln("Failed to fetch user")
+		sendResult(conn, 0x84, "game server not found", pack.TicketId)
 		return
 	}
 
-	server.AddPlayer(conn)
+	name := server.Settings().Name
 
-	user, ok := lobby.GetUser(conn)
-	if !ok {
-		log.Errorln("Failed to fetch user")
+	if !config.Compatible(user.Patchlevel, server.Patchlevel) {
+		log.Infoln("User", user.Name, "tried to join incompatible server", name)
 		sendResult(conn, 0x84, "game server not found", pack.TicketId)
 		return
 	}
 
-	user.JoinedServer = server
+	if !server.CanJoin(user.Uid, user.JoinPasswords[server.Id]) {
+		log.Infoln("User", user.Name, "is not allowed to join private server", name)
+		sendResult(conn, 0x84, "game is private", pack.TicketId)
+		go sendChatMessage(conn, fmt.Sprintf("<< %s is private, ask the host for an invitation or use /joinpass %d <password> >>", name, server.Id), 0)
+		return
+	}
+
+	if !server.Join(conn) {
+		log.Infoln("Lobby", name, "is already full")
+		sendResult(conn, 0x87, "game server full", pack.TicketId)
+		return
+	}
+
+	// only leave the previous game once the new one accepted the user
+	if joined := user.JoinedServer(); joined != nil && joined != server {
+		leaveGameServer(conn, user)
+	}
+	leaveStartedGames(conn, user)
+
+	user.SetJoinedServer(server)
 
 	sendResult(conn, 0, "", pack.TicketId)
+
+	publish(events.PlayerJoined{Time: time.Now(), Server: serverInfo(server), Name: user.Name, Uid: user.Uid})
+	notifyGameServerUpdate(server, 0)
 }
 
 func handleLeaveServer(conn *net.TCPConn, r io.Reader) {
@@ -785,18 +1160,53 @@ func handleLeaveServer(conn *net.TCPConn, r io.Reader) {
 		return
 	}
 
-	user, ok := lobby.GetUser(conn)
+	user, ok := lob.GetUser(conn)
 	if !ok {
 		log.Errorln("Failed to fetch user")
 		return
 	}
 
-	if user.JoinedServer != nil {
-		user.JoinedServer.RemovePlayer(conn)
-		user.JoinedServer = nil
+	if user.JoinedServer() != nil {
+		leaveGameServer(conn, user)
 
 		sendResult(conn, 0, "", pack.TicketId)
 	} else {
 		sendResult(conn, 1, "user has not joined any server", pack.TicketId)
 	}
 }
+
+// leaveGameServer removes the user from the joined server and updates the player count
+func leaveGameServer(conn *net.TCPConn, user *lobby.Account) {
+	server := user.LeaveJoinedServer()
+
+	if server == nil || !server.RemovePlayer(conn) {
+		return
+	}
+
+	publish(events.PlayerLeft{Time: time.Now(), Server: serverInfo(server), Name: user.Name, Uid: user.Uid})
+
+	// started games are not listed anymore
+	if _, ok := lob.GetServerById(server.Id); !ok {
+		forgetGameIfEmpty(server)
+		return
+	}
+	notifyGameServerUpdate(server, 0)
+}
+
+func notifyHost(serverId uint32, msg string) {
+	server, ok := lob.GetServerById(serverId)
+	if ok && server.Host != nil {
+		go sendChatMessage(server.Host, msg, 0)
+	}
+}
+
+// playerNames returns the names of the players in the server which are still online
+func playerNames(server *lobby.Server) []string {
+	var names []string
+	for _, c := range server.GetPlayers() {
+		if u, ok := lob.GetUser(c); ok {
+			names = append(names, u.Name)
+		}
+	}
+	return names
+}
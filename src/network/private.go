@@ -0,0 +1,115 @@
+package network
+
+import (
+	"strconv"
+
+	"s2dnglobby/chatcmd"
+	"s2dnglobby/lobby"
+)
+
+/*
+* Password protected and invite-only games, managed by the host from the chat.
+* Joiners give the password with /joinpass before joining in the client.
+ */
+
+func registerPrivateCommands() {
+	commands.Register(&chatcmd.Command{
+		Name:  "private",
+		Usage: "[password]",
+		Help:  "protect your game with a password, invite-only without one",
+		Run:   hostCommand(cmdPrivate),
+	})
+	commands.Register(&chatcmd.Command{
+		Name: "public",
+		Help: "let everyone join your game again",
+		Run: hostCommand(func(ctx *chatcmd.Context, server *lobby.Server) {
+			server.MakePublic()
+			ctx.Reply("your game is public now")
+		}),
+	})
+	commands.Register(&chatcmd.Command{
+		Name:    "invite",
+		Usage:   "<user>",
+		Help:    "allow a user to join your private game",
+		MinArgs: 1,
+		Run: hostCommand(func(ctx *chatcmd.Context, server *lobby.Server) {
+			setInvite(ctx, server, true)
+		}),
+	})
+	commands.Register(&chatcmd.Command{
+		Name:    "uninvite",
+		Usage:   "<user>",
+		Help:    "withdraw an invitation",
+		MinArgs: 1,
+		Run: hostCommand(func(ctx *chatcmd.Context, server *lobby.Server) {
+			setInvite(ctx, server, false)
+		}),
+	})
+	commands.Register(&chatcmd.Command{
+		Name:    "joinpass",
+		Usage:   "<game id> <password>",
+		Help:    "give the password of a private game before joining it",
+		MinArgs: 2,
+		Run:     cmdJoinPass,
+	})
+}
+
+// hostCommand only runs the command if the user hosts a game
+func hostCommand(run func(ctx *chatcmd.Context, server *lobby.Server)) func(ctx *chatcmd.Context) {
+	return func(ctx *chatcmd.Context) {
+		server, ok := lob.GetServer(ctx.User.Connection)
+		if !ok {
+			ctx.Reply("you are not hosting a game")
+			return
+		}
+		run(ctx, server)
+	}
+}
+
+func cmdPrivate(ctx *chatcmd.Context, server *lobby.Server) {
+	if len(ctx.Args) == 0 {
+		server.SetPassword("")
+		server.SetInviteOnly(true)
+		ctx.Reply("your game is invite-only now, use /invite <user>")
+		return
+	}
+
+	server.SetInviteOnly(false)
+	server.SetPassword(ctx.Args[0])
+	ctx.Replyf("your game is password protected now, players join with /joinpass %d <password>", server.Id)
+}
+
+func setInvite(ctx *chatcmd.Context, server *lobby.Server, invited bool) {
+	user, ok := lob.GetUserByName(ctx.Args[0])
+	if !ok {
+		ctx.Replyf("%s is not online", ctx.Args[0])
+		return
+	}
+
+	server.Invite(user.Uid, invited)
+
+	if invited {
+		ctx.Replyf("%s may join your game now", user.Name)
+		go sendChatMessage(user.Connection, "<< "+ctx.User.Name+" invited you to the game "+server.Settings().Name+" >>", 0)
+	} else {
+		ctx.Replyf("invitation of %s withdrawn", user.Name)
+	}
+}
+
+func cmdJoinPass(ctx *chatcmd.Context) {
+	id, err := strconv.ParseUint(ctx.Args[0], 10, 32)
+	if err != nil {
+		ctx.Replyf("invalid game id %s", ctx.Args[0])
+		return
+	}
+	if _, ok := lob.GetServerById(uint32(id)); !ok {
+		ctx.Replyf("game %d not found", id)
+		return
+	}
+
+	if ctx.User.JoinPasswords == nil {
+		ctx.User.JoinPasswords = make(map[uint32]string)
+	}
+	ctx.User.JoinPasswords[uint32(id)] = ctx.Args[1]
+	ctx.Reply("password saved, you can join the game now")
+}
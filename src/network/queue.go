@@ -0,0 +1,289 @@
+package network
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"s2dnglobby/chatcmd"
+	"s2dnglobby/config"
+	"s2dnglobby/events"
+	"s2dnglobby/library"
+	"s2dnglobby/lobby"
+)
+
+/*
+* Quick match: players wait in the queue until enough compatible players want the same
+* game or an open game with AutomaticJoin fits. The client cannot be told to join a game,
+* so everybody gets a chat notice which game to host or to join.
+ */
+
+const maxMatchSize = 8
+const defaultQueueTimeout = 30 * time.Minute // if QueueTimeoutMinutes is not set
+const matchTimeout = 10 * time.Minute        // for the host to create the game
+
+func registerQueueCommands() {
+	commands.Register(&chatcmd.Command{
+		Name:  "queue",
+		Usage: "[<mode|any> [size] | leave]",
+		Help:  "wait for a quick match, mode is the GameMode number or name, size the number of players",
+		Run:   cmdQueue,
+	})
+}
+
+func initQueueAPI() {
+	// players waiting for a quick match
+	http.HandleFunc("/api/queue", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		library.WriteJSONResponse(w, lob.Queue().Entries())
+	})
+}
+
+func cmdQueue(ctx *chatcmd.Context) {
+	q := lob.Queue()
+
+	if len(ctx.Args) == 0 {
+		if m, ok := q.MatchOf(ctx.User.Uid); ok {
+			if m.Host.Uid == ctx.User.Uid {
+				ctx.Replyf("create %s for your quick match, or cancel it with /queue leave", describeMatch(m.Mode, m.Size))
+			} else {
+				ctx.Replyf("%s hosts your quick match, join it when it shows up", m.Host.Name)
+			}
+		} else if e, ok := q.Get(ctx.User.Uid); ok {
+			ctx.Replyf("you are waiting for %s since %s, %d players in the queue",
+				describeMatch(e.Mode, e.Size), time.Since(e.Since).Truncate(time.Second), len(q.Entries()))
+		} else {
+			cmd, _ := commands.Get("queue")
+			ctx.Replyf("you are not in the queue, %d players waiting\n%s", len(q.Entries()), cmd.UsageLine())
+		}
+		return
+	}
+
+	if ctx.Args[0] == "leave" {
+		if m, ok := q.TakeMatch(ctx.User.Uid); ok {
+			requeueMatch(m, fmt.Sprintf("<< %s cancelled the quick match, you are back in the queue >>", m.Host.Name))
+			ctx.Reply("you cancelled your quick match")
+			go runMatchmaking()
+		} else if q.Remove(ctx.User.Uid) {
+			ctx.Reply("you left the queue")
+		} else {
+			ctx.Reply("you are not in the queue")
+		}
+		return
+	}
+
+	if _, ok := lob.GetServer(ctx.User.Connection); ok {
+		ctx.Reply("you are hosting a game already")
+		return
+	}
+	if m, ok := q.MatchOf(ctx.User.Uid); ok {
+		if m.Host.Uid == ctx.User.Uid {
+			ctx.Reply("create the game of your quick match first, or cancel it with /queue leave")
+		} else {
+			ctx.Replyf("you are waiting for the quick match game of %s already", m.Host.Name)
+		}
+		return
+	}
+
+	mode, ok := parseGameMode(ctx.Args[0])
+	if !ok {
+		ctx.Replyf("unknown mode %s", ctx.Args[0])
+		return
+	}
+
+	size := 0
+	if len(ctx.Args) > 1 {
+		n, err := strconv.Atoi(ctx.Args[1])
+		if err != nil || n < 2 || n > maxMatchSize {
+			ctx.Replyf("size has to be between 2 and %d", maxMatchSize)
+			return
+		}
+		size = n
+	}
+
+	q.Enqueue(lobby.QueueEntry{
+		Uid:        ctx.User.Uid,
+		Name:       ctx.User.Name,
+		Patchlevel: ctx.User.Patchlevel,
+		Mode:       mode,
+		Size:       size,
+		Since:      time.Now(),
+	})
+	ctx.Replyf("you are waiting for %s, %d players in the queue", describeMatch(mode, size), len(q.Entries()))
+	log.Infoln("User", ctx.User.Name, "queued for", describeMatch(mode, size))
+
+	go runMatchmaking()
+}
+
+func parseGameMode(s string) (int, bool) {
+	if strings.EqualFold(s, "any") {
+		return lobby.AnyMode, true
+	}
+	for name, mode := range config.Cfg.GameModeNames {
+		if strings.EqualFold(name, s) {
+			return int(mode), true
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 8)
+	return int(n), err == nil
+}
+
+func gameModeName(mode int) string {
+	if mode == lobby.AnyMode {
+		return "any mode"
+	}
+	for name, m := range config.Cfg.GameModeNames {
+		if int(m) == mode {
+			return "mode " + name
+		}
+	}
+	return fmt.Sprintf("mode %d", mode)
+}
+
+func describeMatch(mode, size int) string {
+	if size == 0 {
+		return "a game in " + gameModeName(mode)
+	}
+	return fmt.Sprintf("a %d player game in %s", size, gameModeName(mode))
+}
+
+// runMatchmaking sends waiting players to open games and forms new matches
+func runMatchmaking() {
+	for _, s := range lob.Servers() {
+		offerServer(s)
+	}
+
+	for {
+		m, ok := lob.Queue().FormMatch(config.Compatible, time.Now())
+		if !ok {
+			return
+		}
+		notifyMatch(m)
+	}
+}
+
+// offerServer sends waiting players to an open game with AutomaticJoin
+func offerServer(server *lobby.Server) {
+	g := server.Settings()
+	if !server.AutomaticJoin || g.Running || server.IsPrivate() {
+		return
+	}
+
+	if server.IsFull() {
+		return
+	}
+
+	for _, e := range lob.Queue().TakeForServer(server, config.Compatible) {
+		msg := fmt.Sprintf("<< quick match: join the game %s (#%d) of %s on %s >>", g.Name, server.Id, server.OwnerName, g.Map)
+		sendToQueued(e, msg)
+		notifyHost(server.Id, fmt.Sprintf("<< quick match sent %s to your game >>", e.Name))
+		log.Infoln("Quick match sent", e.Name, "to", g.Name)
+	}
+}
+
+func offerServerById(id uint32) {
+	if server, ok := lob.GetServerById(id); ok {
+		offerServer(server)
+	}
+}
+
+func notifyMatch(m lobby.Match) {
+	names := make([]string, len(m.Players))
+	for i, p := range m.Players {
+		names[i] = p.Name
+	}
+	sort.Strings(names)
+
+	sendToQueued(m.Host, fmt.Sprintf("<< quick match with %s: create %s, they get told when it is open >>",
+		strings.Join(names, ", "), describeMatch(m.Mode, m.Size)))
+	for _, p := range m.Players {
+		sendToQueued(p, fmt.Sprintf("<< quick match: %s hosts %s, join it when it shows up >>", m.Host.Name, describeMatch(m.Mode, m.Size)))
+	}
+
+	log.Infoln("Quick match formed:", m.Host.Name, "hosts for", strings.Join(names, ", "))
+}
+
+func sendToQueued(e lobby.QueueEntry, msg string) {
+	if u, ok := lob.GetUserByName(e.Name); ok && u.Uid == e.Uid {
+		go sendChatMessage(u.Connection, msg, 0)
+	}
+}
+
+// subscribeMatchmaking keeps the queue up to date with the lobby
+func subscribeMatchmaking(b *events.Bus) {
+	b.Subscribe("matchmaking", func(e events.Event) {
+		q := lob.Queue()
+
+		switch e := e.(type) {
+		case events.ServerCreated:
+			q.Remove(e.Server.OwnerId)
+			server, ok := lob.GetServerById(e.Server.Id)
+			if !ok {
+				return
+			}
+			if m, ok := q.TakeMatch(e.Server.OwnerId); ok {
+				for _, p := range m.Players {
+					server.Invite(p.Uid, true)
+					sendToQueued(p, fmt.Sprintf("<< %s opened the quick match game %s (#%d), join it now >>", m.Host.Name, e.Server.Name, e.Server.Id))
+				}
+			}
+			offerServer(server)
+
+		case events.ServerChanged:
+			offerServerById(e.Server.Id)
+
+		case events.PlayerLeft:
+			offerServerById(e.Server.Id)
+
+		case events.PlayerJoined:
+			q.Remove(e.Uid)
+
+		case events.UserLoggedOut:
+			q.Remove(e.Uid)
+			// the players of a match without host wait again
+			if m, ok := q.TakeMatch(e.Uid); ok {
+				requeueMatch(m, "<< the host of your quick match left, you are back in the queue >>")
+				runMatchmaking()
+			}
+		}
+	})
+}
+
+// requeueMatch puts the players of a cancelled match back in the queue
+func requeueMatch(m lobby.Match, msg string) {
+	for _, p := range m.Players {
+		p.Since = time.Now()
+		lob.Queue().Enqueue(p)
+		sendToQueued(p, msg)
+	}
+}
+
+// expireQueue removes players waiting too long and matches whose host did not
+// create the game in time, called by the reaper
+func expireQueue(now time.Time) {
+	q := lob.Queue()
+
+	timeout := time.Duration(config.Cfg.QueueTimeoutMinutes) * time.Minute
+	if timeout <= 0 {
+		timeout = defaultQueueTimeout
+	}
+	for _, e := range q.Expire(now.Add(-timeout)) {
+		sendToQueued(e, fmt.Sprintf("<< no quick match found within %d minutes, you left the queue >>", int(timeout.Minutes())))
+	}
+
+	expired := q.ExpireMatches(now.Add(-matchTimeout))
+	for _, m := range expired {
+		log.Infoln("Quick match of", m.Host.Name, "expired")
+		sendToQueued(m.Host, fmt.Sprintf("<< you did not create the quick match game within %d minutes, the match was cancelled >>", int(matchTimeout.Minutes())))
+		requeueMatch(m, fmt.Sprintf("<< %s did not create the quick match game in time, you are back in the queue >>", m.Host.Name))
+	}
+	if len(expired) > 0 {
+		runMatchmaking()
+	}
+}
@@ -0,0 +1,126 @@
+package network
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"s2dnglobby/config"
+	"s2dnglobby/lobby"
+)
+
+/*
+* Removes game servers which have not been updated within their TTL
+* or which are not reachable anymore.
+ */
+
+const reaperInterval = time.Minute
+const probeTimeout = 3 * time.Second
+const probeParallel = 16 // probes running at the same time
+
+// failed probes in a row per ServerId, only used by the reaper goroutine
+var probeFailures = make(map[uint32]int)
+
+func startReaper() {
+	go func() {
+		for {
+			time.Sleep(reaperInterval)
+			reapServers(time.Now())
+			expireQueue(time.Now())
+		}
+	}()
+}
+
+// staleServer is a server to remove and the reason shown to its host
+type staleServer struct {
+	server *lobby.Server
+	reason string
+}
+
+func reapServers(now time.Time) {
+	ttl := time.Duration(config.Cfg.ServerTTLMinutes) * time.Minute
+	runningTTL := time.Duration(config.Cfg.RunningServerTTLMinutes) * time.Minute
+
+	var stale []staleServer
+	var probe []*lobby.Server
+	alive := make(map[uint32]bool)
+
+	for _, s := range lob.Servers() {
+		alive[s.Id] = true
+		g := s.Settings()
+
+		if s.Expired(now, ttl, runningTTL) {
+			log.Infoln("Removing stale server", g.Name+": not updated since", g.Updated.Format(time.RFC3339))
+			stale = append(stale, staleServer{s, "it was not updated anymore"})
+			continue
+		}
+
+		if config.Cfg.ServerProbe && !g.Running {
+			probe = append(probe, s)
+		}
+	}
+
+	reachable := probeServers(probe)
+	for i, s := range probe {
+		if reachable[i] {
+			delete(probeFailures, s.Id)
+			continue
+		}
+		probeFailures[s.Id]++
+		if probeFailures[s.Id] >= max(config.Cfg.ServerProbeFailures, 1) {
+			log.Infoln("Removing stale server", s.Settings().Name+": not reachable")
+			stale = append(stale, staleServer{s, "it is not reachable from the internet"})
+		}
+	}
+
+	for id := range probeFailures {
+		if !alive[id] {
+			delete(probeFailures, id)
+		}
+	}
+
+	for _, st := range stale {
+		s := st.server
+		delete(probeFailures, s.Id)
+
+		// the host might have created a new server in the meantime
+		if current, ok := lob.GetServer(s.Host); ok && current == s {
+			removeGameServer(s.Host, 0, "stale")
+			go sendChatMessage(s.Host, "<< Your game "+s.Settings().Name+" was removed from the list because "+st.reason+" >>", 0)
+		}
+	}
+}
+
+// probeServers probes up to probeParallel servers at once,
+// the result has the same order as the servers
+func probeServers(servers []*lobby.Server) []bool {
+	reachable := make([]bool, len(servers))
+	sem := make(chan struct{}, probeParallel)
+	var wg sync.WaitGroup
+
+	for i, s := range servers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, s *lobby.Server) {
+			defer wg.Done()
+			reachable[i] = probeServer(s)
+			<-sem
+		}(i, s)
+	}
+
+	wg.Wait()
+	return reachable
+}
+
+func probeServer(s *lobby.Server) bool {
+	addr := net.JoinHostPort(s.IP, strconv.Itoa(int(s.Port)))
+
+	c, err := net.DialTimeout("tcp", addr, probeTimeout)
+	if err != nil {
+		log.Debugln("Probe of server", s.Settings().Name, "at", addr, "failed:", err)
+		return false
+	}
+	c.Close()
+	return true
+}
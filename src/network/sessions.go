@@ -0,0 +1,93 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"s2dnglobby/chatcmd"
+	"s2dnglobby/events"
+	"s2dnglobby/history"
+	"s2dnglobby/lobby"
+)
+
+/*
+* Started games are kept here until all players hosted or joined another game
+* or disconnected. Every player leaving publishes PlayerLeft, the history
+* subscriber uses it to approximate the end of the game.
+ */
+
+const historyCommandLimit = 5
+
+var startedGames = make(map[*lobby.Server]bool)
+var startedGamesLock sync.Mutex
+
+func trackStartedGame(server *lobby.Server) {
+	startedGamesLock.Lock()
+	startedGames[server] = true
+	startedGamesLock.Unlock()
+}
+
+// leaveStartedGames removes the user from all started games,
+// called when a player is back in the lobby or disconnects
+func leaveStartedGames(conn *net.TCPConn, user *lobby.Account) {
+	startedGamesLock.Lock()
+	var games []*lobby.Server
+	for s := range startedGames {
+		games = append(games, s)
+	}
+	startedGamesLock.Unlock()
+
+	for _, s := range games {
+		if s.RemovePlayer(conn) {
+			publish(events.PlayerLeft{Time: time.Now(), Server: serverInfo(s), Name: user.Name, Uid: user.Uid})
+		}
+		forgetGameIfEmpty(s)
+	}
+}
+
+func forgetGameIfEmpty(server *lobby.Server) {
+	if server.GetPlayerCount() > 0 {
+		return
+	}
+
+	startedGamesLock.Lock()
+	delete(startedGames, server)
+	startedGamesLock.Unlock()
+}
+
+func registerHistoryCommands() {
+	commands.Register(&chatcmd.Command{
+		Name:  "history",
+		Usage: "[user]",
+		Help:  "show recently started games",
+		Run:   cmdHistory,
+	})
+}
+
+func cmdHistory(ctx *chatcmd.Context) {
+	q := history.Query{Limit: historyCommandLimit}
+	if len(ctx.Args) > 0 {
+		q.User = ctx.Args[0]
+	}
+
+	games := history.Search(q)
+	if len(games) == 0 {
+		ctx.Reply("no games recorded")
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("recent games:")
+	for _, g := range games {
+		fmt.Fprintf(&b, "\n[%s] %s on %s by %s: %s", g.Started.Format("01-02 15:04"), g.Name, g.Map, g.Host, strings.Join(g.Players, ", "))
+		if g.Ended.IsZero() {
+			b.WriteString(" (running)")
+		} else {
+			fmt.Fprintf(&b, " (%s)", g.Ended.Sub(g.Started).Round(time.Minute))
+		}
+	}
+	ctx.Reply(b.String())
+}
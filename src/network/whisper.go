@@ -0,0 +1,80 @@
+package network
+
+import (
+	"fmt"
+	"time"
+
+	"s2dnglobby/chatcmd"
+	"s2dnglobby/chatlog"
+	"s2dnglobby/config"
+	"s2dnglobby/events"
+	"s2dnglobby/lobby"
+)
+
+/*
+* Private messages between two logged in users.
+* The client has no recipient field, so the text starts with the recipient
+* name, both for the /w command and for ChatMessages sent with WhisperMode.
+ */
+
+func registerWhisperCommands() {
+	commands.Register(&chatcmd.Command{
+		Name:    "w",
+		Aliases: []string{"whisper", "msg"},
+		Usage:   "<user> <text>",
+		Help:    "send a private message",
+		MinArgs: 2,
+		RawArgs: true,
+		Run: func(ctx *chatcmd.Context) {
+			name, txt := chatcmd.CutArg(ctx.Raw)
+			sendWhisper(ctx.User, name, txt)
+		},
+	})
+}
+
+// isWhisperMode checks if the ChatMessage Mode is used by the client for private chat
+func isWhisperMode(mode uint32) bool {
+	return config.Cfg.WhisperMode != 0 && mode == config.Cfg.WhisperMode
+}
+
+// handleWhisperMessage handles a ChatMessage sent with WhisperMode, "<user> <text>"
+func handleWhisperMessage(from *lobby.Account, txt string) {
+	name, msg := chatcmd.CutArg(txt)
+	if name == "" || msg == "" {
+		sendChatMessage(from.Connection, "usage: <user> <text>", 0)
+		return
+	}
+
+	sendWhisper(from, name, msg)
+}
+
+func sendWhisper(from *lobby.Account, name string, txt string) {
+	to, ok := lob.GetUserByName(name)
+	if !ok {
+		sendChatMessage(from.Connection, fmt.Sprintf("%s is not online", name), 0)
+		return
+	}
+	if to.Connection == from.Connection {
+		sendChatMessage(from.Connection, "You cannot whisper to yourself", 0)
+		return
+	}
+
+	txt, ok = filterChat(from, txt)
+	if !ok {
+		return
+	}
+
+	publish(events.ChatPosted{
+		Time:     time.Now(),
+		FromId:   from.Uid,
+		FromName: from.Name,
+		Mode:     chatlog.ModeWhisper,
+		To:       to.Name,
+		Txt:      txt,
+	})
+
+	go sendChatMessage(to.Connection, "(whisper) "+txt, from.Uid)
+	go sendChatMessage(from.Connection, fmt.Sprintf("(to %s) %s", to.Name, txt), from.Uid)
+
+	log.Debugln("Whisper from", from.Name, "to", to.Name)
+}
@@ -0,0 +1,55 @@
+package profiles
+
+import (
+	"net/http"
+	"time"
+
+	"s2dnglobby/library"
+)
+
+// profileResponse adds the derived values to the stored profile
+type profileResponse struct {
+	Profile
+	Online        bool
+	OnlineTime    string
+	FavouriteMaps []string
+	UsualHour     int // UTC, -1 if unknown
+}
+
+func initAPI() {
+	// all profiles, most recently seen first, or a single one with ?name=<name>
+	http.HandleFunc("/api/profiles", handleProfiles)
+}
+
+func handleProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if name := r.URL.Query().Get("name"); name != "" {
+		p, ok := Get(name)
+		if !ok {
+			http.Error(w, "profile not found", http.StatusNotFound)
+			return
+		}
+		library.WriteJSONResponse(w, response(p))
+		return
+	}
+
+	var res []profileResponse
+	for _, p := range List() {
+		res = append(res, response(p))
+	}
+	library.WriteJSONResponse(w, res)
+}
+
+func response(p Profile) profileResponse {
+	return profileResponse{
+		Profile:       p,
+		Online:        p.Online,
+		OnlineTime:    p.OnlineTime().Truncate(time.Minute).String(),
+		FavouriteMaps: p.FavouriteMaps(3),
+		UsualHour:     p.UsualHour(),
+	}
+}
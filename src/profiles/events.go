@@ -0,0 +1,19 @@
+package profiles
+
+import "s2dnglobby/events"
+
+// Subscribe keeps the profiles up to date from the lobby events
+func Subscribe(b *events.Bus) {
+	b.Subscribe("profiles", func(e events.Event) {
+		switch e := e.(type) {
+		case events.UserLoggedIn:
+			if !e.Guest {
+				Login(e.Name, e.Patchlevel, e.Time)
+			}
+		case events.UserLoggedOut:
+			Logout(e.Name, e.Time)
+		case events.ServerStarted:
+			GameStarted(e.Server.Host, e.Players, e.Server.Map)
+		}
+	})
+}
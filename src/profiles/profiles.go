@@ -0,0 +1,229 @@
+package profiles
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"s2dnglobby/config"
+	"s2dnglobby/library"
+)
+
+var log = library.GetLogger("Profiles")
+
+/*
+* Activity statistics per account, built from logins, logouts and started games.
+* Guests do not get a profile.
+ */
+
+type Profile struct {
+	Name           string
+	FirstSeen      time.Time
+	LastSeen       time.Time
+	OnlineSeconds  int64 // total time logged in, without the running session
+	Logins         int
+	GamesHosted    int
+	GamesJoined    int
+	Maps           map[string]int // started games per map
+	ActiveHours    [24]int        // logins per hour of the day (UTC)
+	LastPatchlevel uint32
+
+	Online bool `json:"-"`
+}
+
+// FavouriteMaps returns up to n maps, most played first
+func (p *Profile) FavouriteMaps(n int) []string {
+	maps := make([]string, 0, len(p.Maps))
+	for m := range p.Maps {
+		maps = append(maps, m)
+	}
+	sort.Slice(maps, func(i, j int) bool {
+		if p.Maps[maps[i]] != p.Maps[maps[j]] {
+			return p.Maps[maps[i]] > p.Maps[maps[j]]
+		}
+		return maps[i] < maps[j]
+	})
+	return maps[:min(n, len(maps))]
+}
+
+// UsualHour is the hour of the day (UTC) the user logs in most often, -1 if unknown
+func (p *Profile) UsualHour() int {
+	hour, best := -1, 0
+	for h, n := range p.ActiveHours {
+		if n > best {
+			hour, best = h, n
+		}
+	}
+	return hour
+}
+
+func (p *Profile) OnlineTime() time.Duration {
+	return time.Duration(p.OnlineSeconds) * time.Second
+}
+
+var path string
+var profiles = make(map[string]*Profile) // by normalized name
+var sessions = make(map[string]time.Time) // login time of online users
+var lock sync.Mutex
+var saver = library.NewSaver(config.SaveDelay, save)
+
+func InitProfiles() error {
+	path = filepath.Join(config.DataDir, "profiles.json")
+
+	p := make(map[string]*Profile)
+	if err := library.ReadJSON(path, &p); err != nil {
+		return fmt.Errorf("failed to load profiles: %w", err)
+	}
+	profiles = p
+
+	initAPI()
+
+	log.Infoln("Profiles initialized with", len(profiles), "accounts")
+	return nil
+}
+
+// get returns the profile, creating it if needed, has to be called with the lock held
+func get(name string, now time.Time) *Profile {
+	key := library.NormalizeName(name)
+
+	p, ok := profiles[key]
+	if !ok {
+		p = &Profile{Name: name, FirstSeen: now}
+		profiles[key] = p
+	}
+	if p.Maps == nil {
+		p.Maps = make(map[string]int)
+	}
+	return p
+}
+
+func Login(name string, patchlevel uint32, now time.Time) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	p := get(name, now)
+	p.Name = name
+	p.LastSeen = now
+	p.Logins++
+	p.ActiveHours[now.UTC().Hour()]++
+	p.LastPatchlevel = patchlevel
+
+	sessions[library.NormalizeName(name)] = now
+	saver.Trigger()
+}
+
+func Logout(name string, now time.Time) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	key := library.NormalizeName(name)
+	start, ok := sessions[key]
+	if !ok {
+		return
+	}
+	delete(sessions, key)
+
+	p := get(name, now)
+	p.LastSeen = now
+	p.OnlineSeconds += int64(now.Sub(start) / time.Second)
+	saver.Trigger()
+}
+
+// GameStarted counts the game for the host and all players, guests are ignored
+func GameStarted(host string, players []string, mapName string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	now := time.Now()
+
+	for _, name := range players {
+		key := library.NormalizeName(name)
+		if _, ok := sessions[key]; !ok {
+			continue // no profile, e.g. guest
+		}
+
+		p := get(name, now)
+		if key == library.NormalizeName(host) {
+			p.GamesHosted++
+		} else {
+			p.GamesJoined++
+		}
+		if mapName != "" {
+			p.Maps[mapName]++
+		}
+	}
+	saver.Trigger()
+}
+
+// Get returns a copy of the profile, the online time includes the running session
+func Get(name string) (Profile, bool) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	p, ok := profiles[library.NormalizeName(name)]
+	if !ok {
+		return Profile{}, false
+	}
+	return snapshot(p, time.Now()), true
+}
+
+// List returns all profiles, most recently seen first
+func List() []Profile {
+	lock.Lock()
+	defer lock.Unlock()
+
+	now := time.Now()
+	res := make([]Profile, 0, len(profiles))
+	for _, p := range profiles {
+		res = append(res, snapshot(p, now))
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].LastSeen.After(res[j].LastSeen)
+	})
+	return res
+}
+
+// snapshot has to be called with the lock held
+func snapshot(p *Profile, now time.Time) Profile {
+	c := *p
+	c.Maps = make(map[string]int, len(p.Maps))
+	for m, n := range p.Maps {
+		c.Maps[m] = n
+	}
+
+	if start, ok := sessions[library.NormalizeName(p.Name)]; ok {
+		c.Online = true
+		c.LastSeen = now
+		c.OnlineSeconds += int64(now.Sub(start) / time.Second)
+	}
+	return c
+}
+
+// Flush writes pending changes to disk
+func Flush() {
+	saver.Flush()
+}
+
+func save() {
+	lock.Lock()
+	if path == "" {
+		lock.Unlock()
+		return
+	}
+	c := make(map[string]*Profile, len(profiles))
+	for key, p := range profiles {
+		cp := *p
+		cp.Maps = make(map[string]int, len(p.Maps))
+		for m, n := range p.Maps {
+			cp.Maps[m] = n
+		}
+		c[key] = &cp
+	}
+	lock.Unlock()
+
+	if err := library.WriteJSON(path, c); err != nil {
+		log.Errorln("Failed to store profiles:", err)
+	}
+}
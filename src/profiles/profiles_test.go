@@ -0,0 +1,54 @@
+package profiles_test
+
+import (
+	"testing"
+	"time"
+
+	"s2dnglobby/profiles"
+)
+
+func TestLoginLogout(t *testing.T) {
+	login := time.Date(2023, 5, 1, 18, 0, 0, 0, time.UTC)
+
+	profiles.Login("Alice", 11757, login)
+	profiles.Logout("alice", login.Add(90*time.Minute))
+	profiles.Logout("alice", login.Add(3*time.Hour)) // not logged in anymore
+
+	p, ok := profiles.Get("ALICE")
+	if !ok {
+		t.Fatal("profile not found")
+	}
+	if p.Logins != 1 || p.OnlineTime() != 90*time.Minute || p.Online {
+		t.Errorf("unexpected profile: %+v", p)
+	}
+	if !p.FirstSeen.Equal(login) || p.UsualHour() != 18 || p.LastPatchlevel != 11757 {
+		t.Errorf("unexpected profile: %+v", p)
+	}
+}
+
+func TestGameStarted(t *testing.T) {
+	now := time.Now()
+	profiles.Login("host", 0, now)
+	profiles.Login("player", 0, now)
+
+	profiles.GameStarted("host", []string{"host", "player", "guest"}, "Greenland")
+	profiles.GameStarted("player", []string{"player"}, "Islands")
+	profiles.GameStarted("player", []string{"player"}, "Islands")
+
+	h, _ := profiles.Get("host")
+	if h.GamesHosted != 1 || h.GamesJoined != 0 {
+		t.Errorf("unexpected host profile: %+v", h)
+	}
+
+	p, _ := profiles.Get("player")
+	if p.GamesHosted != 2 || p.GamesJoined != 1 || !p.Online {
+		t.Errorf("unexpected player profile: %+v", p)
+	}
+	if maps := p.FavouriteMaps(5); len(maps) != 2 || maps[0] != "Islands" {
+		t.Errorf("unexpected favourite maps: %v", maps)
+	}
+
+	if _, ok := profiles.Get("guest"); ok {
+		t.Error("guest should not get a profile")
+	}
+}
@@ -0,0 +1,46 @@
+package quarantine
+
+import (
+	"net/http"
+	"strconv"
+
+	"s2dnglobby/library"
+)
+
+const defaultEntryLimit = 50
+
+func initAPI() {
+	// list all unknown MsgTypes and how often they have been seen
+	http.HandleFunc("/api/quarantine", library.AdminOnly(handleStats))
+
+	// list stored entries, optionally filtered by ?type=<MsgType>&limit=<n>
+	http.HandleFunc("/api/quarantine/entries", library.AdminOnly(handleEntries))
+}
+
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	library.WriteJSONResponse(w, GetStats())
+}
+
+func handleEntries(w http.ResponseWriter, r *http.Request) {
+	msgType := -1
+	limit := defaultEntryLimit
+
+	if v := r.URL.Query().Get("type"); v != "" {
+		t, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			http.Error(w, "invalid type", http.StatusBadRequest)
+			return
+		}
+		msgType = int(t)
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+
+	library.WriteJSONResponse(w, GetEntries(msgType, limit))
+}
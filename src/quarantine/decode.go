@@ -0,0 +1,148 @@
+package quarantine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf8"
+)
+
+/*
+* Tincat payloads consist of little endian integers and
+* length prefixed (uint32) strings and byte slices, see packages.go.
+* GuessFields walks the payload and tries to recognize those layouts.
+ */
+
+type Field struct {
+	Offset int
+	Kind   string // uint16 | uint32 | string | bytes | padding
+	Value  string
+}
+
+const minStringLen = 2 // including the null terminator
+const maxTrailingSize = 16
+
+func GuessFields(payload []byte) []Field {
+	var fields []Field
+	offset := 0
+
+	// every message starts with its type
+	if len(payload) >= 2 {
+		fields = append(fields, Field{
+			Offset: 0,
+			Kind:   "uint16",
+			Value:  fmt.Sprint(binary.LittleEndian.Uint16(payload)),
+		})
+		offset = 2
+	}
+
+	for offset < len(payload) {
+		rest := payload[offset:]
+
+		if isPadding(rest) {
+			fields = append(fields, Field{
+				Offset: offset,
+				Kind:   "padding",
+				Value:  fmt.Sprintf("%d zero bytes", len(rest)),
+			})
+			break
+		}
+
+		if f, size, ok := guessString(rest); ok {
+			f.Offset = offset
+			fields = append(fields, f)
+			offset += size
+			continue
+		}
+
+		if len(rest) >= 4 {
+			fields = append(fields, Field{
+				Offset: offset,
+				Kind:   "uint32",
+				Value:  fmt.Sprint(binary.LittleEndian.Uint32(rest)),
+			})
+			offset += 4
+			continue
+		}
+
+		fields = append(fields, Field{
+			Offset: offset,
+			Kind:   "bytes",
+			Value:  fmt.Sprintf("%X", rest),
+		})
+		break
+	}
+
+	return mergeUint32Runs(fields)
+}
+
+// guessString checks if data starts with a length prefixed string or byte slice
+func guessString(data []byte) (Field, int, bool) {
+	if len(data) < 4 {
+		return Field{}, 0, false
+	}
+
+	length := int(binary.LittleEndian.Uint32(data))
+	if length < minStringLen || length > len(data)-4 {
+		return Field{}, 0, false
+	}
+
+	val := data[4 : 4+length]
+
+	if val[length-1] == 0 && isPrintable(val[:length-1]) {
+		return Field{
+			Kind:  "string",
+			Value: string(val[:length-1]),
+		}, 4 + length, true
+	}
+
+	// binary data is only plausible close to the end of the payload,
+	// followed by a few integers at most (Keypool, Patchlevel, TicketId, ...)
+	if rest := len(data) - 4 - length; rest <= maxTrailingSize {
+		return Field{
+			Kind:  "bytes",
+			Value: fmt.Sprintf("%X", val),
+		}, 4 + length, true
+	}
+
+	return Field{}, 0, false
+}
+
+// mergeUint32Runs collapses consecutive uint32 fields into one entry
+func mergeUint32Runs(fields []Field) []Field {
+	var merged []Field
+
+	for _, f := range fields {
+		n := len(merged)
+		if n > 0 && f.Kind == "uint32" && merged[n-1].Kind == "uint32" {
+			merged[n-1].Value += ", " + f.Value
+			continue
+		}
+		merged = append(merged, f)
+	}
+
+	return merged
+}
+
+func isPrintable(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, b := range data {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+func isPadding(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
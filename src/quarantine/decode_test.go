@@ -0,0 +1,27 @@
+package quarantine_test
+
+import (
+	"encoding/hex"
+	"s2dnglobby/quarantine"
+	"testing"
+)
+
+func TestGuessFields(t *testing.T) {
+	// RequestLogin without MsgHeader
+	d, _ := hex.DecodeString("0400050000007465737400070000004156545E58410011000000BCA2BCA3B7BA9C9EBBA7949F97948780000100ED2D000001000000")
+
+	fields := quarantine.GuessFields(d)
+	kinds := []string{"uint16", "string", "string", "bytes", "uint32"}
+
+	if len(fields) < len(kinds) {
+		t.Fatal("expected", len(kinds), "fields, got", fields)
+	}
+	for i, k := range kinds {
+		if fields[i].Kind != k {
+			t.Error("field", i, "expected", k, "got", fields[i])
+		}
+	}
+	if fields[1].Value != "test" {
+		t.Error(fields[1].Value, "!=", "test")
+	}
+}
@@ -0,0 +1,241 @@
+package quarantine
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"s2dnglobby/config"
+	"s2dnglobby/library"
+)
+
+var log = library.GetLogger("Quarantine")
+
+const statsFileName = "stats.json"
+
+// Sensitive reports if messages of the type carry credentials,
+// their payload is never stored: RequestLogin (4) and RequestCreateAccount (71)
+func Sensitive(msgType uint16) bool {
+	return msgType == 4 || msgType == 71
+}
+
+// Message is a raw message as it was received from the client
+type Message struct {
+	Time     time.Time
+	MsgType  uint16
+	Payload  string // hex encoded, empty if redacted
+	Size     int
+	Redacted bool `json:",omitempty"`
+}
+
+func NewMessage(msgType uint16, payload []byte) Message {
+	m := Message{
+		Time:    time.Now(),
+		MsgType: msgType,
+		Size:    len(payload),
+	}
+	if Sensitive(msgType) {
+		m.Redacted = true
+	} else {
+		m.Payload = hex.EncodeToString(payload)
+	}
+	return m
+}
+
+// UserState is a snapshot of the session which sent the message
+type UserState struct {
+	LoggedIn      bool
+	Name          string
+	Uid           uint32
+	ObsUserLogin  bool
+	ObsGlobalChat bool
+	ObsServerList bool
+	OwnsServer    uint32
+	JoinedServer  uint32
+}
+
+type Entry struct {
+	Id      string
+	Time    time.Time
+	Remote  string
+	MsgType uint16
+	Partial bool   // known MsgType, but the payload could not be parsed
+	Error   string `json:",omitempty"`
+	Payload string // hex encoded, empty if redacted
+	Size    int
+
+	Redacted bool `json:",omitempty"` // the payload carried credentials
+
+	User      UserState
+	Preceding []Message
+	Guesses   []Field
+}
+
+type Stat struct {
+	MsgType   uint16
+	Count     int
+	Partial   int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Sizes     []int // distinct payload sizes
+}
+
+var storeDir string
+var entries []string // entry file names, oldest first
+var stats = make(map[uint16]*Stat)
+var storeLock sync.Mutex
+
+func InitQuarantine() {
+	storeDir = filepath.Join(config.DataDir, "quarantine")
+
+	if err := os.MkdirAll(storeDir, 0o755); err != nil {
+		log.Errorln("Failed to create quarantine directory:", err)
+		return
+	}
+
+	files, err := filepath.Glob(filepath.Join(storeDir, "*.entry.json"))
+	if err != nil {
+		log.Errorln(err)
+	}
+	sort.Strings(files) // names start with the timestamp
+	for _, f := range files {
+		entries = append(entries, filepath.Base(f))
+	}
+
+	var list []*Stat
+	if err := library.ReadJSON(filepath.Join(storeDir, statsFileName), &list); err != nil {
+		log.Errorln("Failed to parse quarantine stats:", err)
+	}
+	for _, s := range list {
+		stats[s.MsgType] = s
+	}
+
+	initAPI()
+
+	log.Infoln("Quarantine initialized with", len(entries), "entries")
+}
+
+// Add stores the entry on disk and drops the oldest entries
+// if the store exceeds its limit
+func Add(entry *Entry) {
+	entry.Time = time.Now()
+	entry.Id = fmt.Sprintf("%d_%d", entry.Time.UnixNano(), entry.MsgType)
+
+	if payload, err := hex.DecodeString(entry.Payload); err == nil {
+		entry.Size = len(payload)
+		entry.Guesses = GuessFields(payload)
+	}
+	if Sensitive(entry.MsgType) {
+		entry.Payload = ""
+		entry.Guesses = nil
+		entry.Redacted = true
+	}
+
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	updateStat(entry)
+
+	if storeDir == "" {
+		return
+	}
+
+	name := entry.Id + ".entry.json"
+	if err := library.WriteJSON(filepath.Join(storeDir, name), entry); err != nil {
+		log.Errorln("Failed to store entry:", err)
+	} else {
+		entries = append(entries, name)
+	}
+
+	for len(entries) > config.QuarantineMaxEntries {
+		os.Remove(filepath.Join(storeDir, entries[0]))
+		entries = entries[1:]
+	}
+
+	if err := library.WriteJSON(filepath.Join(storeDir, statsFileName), statList()); err != nil {
+		log.Errorln("Failed to store stats:", err)
+	}
+}
+
+func updateStat(entry *Entry) {
+	s, ok := stats[entry.MsgType]
+	if !ok {
+		s = &Stat{
+			MsgType:   entry.MsgType,
+			FirstSeen: entry.Time,
+		}
+		stats[entry.MsgType] = s
+	}
+
+	s.Count++
+	if entry.Partial {
+		s.Partial++
+	}
+	s.LastSeen = entry.Time
+
+	for _, size := range s.Sizes {
+		if size == entry.Size {
+			return
+		}
+	}
+	s.Sizes = append(s.Sizes, entry.Size)
+}
+
+func statList() []*Stat {
+	list := make([]*Stat, 0, len(stats))
+	for _, s := range stats {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].MsgType < list[j].MsgType
+	})
+	return list
+}
+
+// GetStats returns how often every unknown MsgType has been seen
+func GetStats() []Stat {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	list := make([]Stat, 0, len(stats))
+	for _, s := range statList() {
+		c := *s
+		c.Sizes = append([]int(nil), s.Sizes...)
+		list = append(list, c)
+	}
+	return list
+}
+
+// GetEntries returns the stored entries, newest first;
+// msgType < 0 returns entries of all types
+func GetEntries(msgType int, limit int) []*Entry {
+	storeLock.Lock()
+	names := append([]string(nil), entries...)
+	storeLock.Unlock()
+
+	var list []*Entry
+
+	for i := len(names) - 1; i >= 0 && len(list) < limit; i-- {
+		data, err := os.ReadFile(filepath.Join(storeDir, names[i]))
+		if err != nil {
+			continue // got rotated out in the meantime
+		}
+
+		entry := new(Entry)
+		if err := json.Unmarshal(data, entry); err != nil {
+			log.Errorln("Failed to parse entry", names[i], err)
+			continue
+		}
+		if msgType >= 0 && int(entry.MsgType) != msgType {
+			continue
+		}
+		list = append(list, entry)
+	}
+
+	return list
+}
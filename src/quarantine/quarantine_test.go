@@ -0,0 +1,28 @@
+package quarantine_test
+
+import (
+	"encoding/hex"
+	"s2dnglobby/quarantine"
+	"testing"
+)
+
+func TestCredentialsAreRedacted(t *testing.T) {
+	secret := []byte("\x05\x00user\x00\x07\x00password\x00")
+
+	for _, msgType := range []uint16{4, 71} {
+		m := quarantine.NewMessage(msgType, secret)
+		if m.Payload != "" || !m.Redacted || m.Size != len(secret) {
+			t.Errorf("message %d not redacted: %+v", msgType, m)
+		}
+
+		e := &quarantine.Entry{MsgType: msgType, Payload: hex.EncodeToString(secret)}
+		quarantine.Add(e)
+		if e.Payload != "" || e.Guesses != nil || !e.Redacted || e.Size != len(secret) {
+			t.Errorf("entry %d not redacted: %+v", msgType, e)
+		}
+	}
+
+	if m := quarantine.NewMessage(2, secret); m.Payload == "" || m.Redacted {
+		t.Errorf("chat message should keep its payload: %+v", m)
+	}
+}
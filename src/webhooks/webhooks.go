@@ -0,0 +1,264 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"s2dnglobby/chatlog"
+	"s2dnglobby/config"
+	"s2dnglobby/events"
+	"s2dnglobby/library"
+)
+
+var log = library.GetLogger("Webhooks")
+
+/*
+* Lobby events get posted as JSON to the configured endpoints. Every target has
+* its own bounded queue and worker, so a slow endpoint only delays its own posts.
+ */
+
+const (
+	defaultRetries    = 3
+	defaultRetryDelay = time.Second
+	defaultQueueSize  = 100
+	requestTimeout    = 10 * time.Second
+)
+
+const (
+	SignatureHeader = "X-Lobby-Signature" // "sha256=" + hex HMAC of the body
+	EventHeader     = "X-Lobby-Event"
+)
+
+type Target struct {
+	cfg        config.Webhook
+	name       string // the URL may contain a token, only its host gets logged
+	templates  map[string]*template.Template
+	retries    int
+	retryDelay time.Duration
+	client     *http.Client
+
+	queue chan post
+	done  chan struct{}
+	close sync.Once
+}
+
+type post struct {
+	kind string
+	body []byte
+}
+
+var funcs = template.FuncMap{
+	// json quotes a value for use inside a JSON template
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func InitWebhooks(b *events.Bus) error {
+	for i, cfg := range config.Cfg.Webhooks {
+		t, err := New(cfg)
+		if err != nil {
+			return fmt.Errorf("webhook %d: %w", i+1, err)
+		}
+		b.Subscribe(fmt.Sprintf("webhook %d (%s)", i+1, t.name), t.Handle)
+	}
+
+	if n := len(config.Cfg.Webhooks); n > 0 {
+		log.Infoln("Webhooks initialized with", n, "targets")
+	}
+	return nil
+}
+
+// New checks the config and starts the worker of the target
+func New(cfg config.Webhook) (*Target, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook without URL")
+	}
+
+	t := &Target{
+		cfg:        cfg,
+		name:       redactURL(cfg.URL),
+		templates:  make(map[string]*template.Template),
+		retries:    defaultRetries,
+		retryDelay: time.Duration(cfg.RetryDelayMs) * time.Millisecond,
+		client:     &http.Client{Timeout: requestTimeout},
+		done:       make(chan struct{}),
+	}
+	if cfg.Retries != nil {
+		t.retries = max(*cfg.Retries, 0)
+	}
+	if t.retryDelay == 0 {
+		t.retryDelay = defaultRetryDelay
+	}
+	if t.cfg.QueueSize == 0 {
+		t.cfg.QueueSize = defaultQueueSize
+	}
+	t.queue = make(chan post, t.cfg.QueueSize)
+
+	for kind, text := range cfg.Templates {
+		tmpl, err := template.New(kind).Funcs(funcs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s: invalid template for %s: %w", t.name, kind, err)
+		}
+		t.templates[kind] = tmpl
+	}
+
+	go t.run()
+	return t, nil
+}
+
+// redactURL returns the host of the URL, paths and user info often carry tokens
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "invalid URL"
+	}
+	return u.Host
+}
+
+// Handle queues the event if the target wants it, never blocks
+func (t *Target) Handle(e events.Event) {
+	if !t.wants(e) {
+		return
+	}
+
+	body, err := t.render(e)
+	if err != nil {
+		log.Errorln("Failed to render", e.Kind(), "for", t.name+":", err)
+		return
+	}
+
+	select {
+	case t.queue <- post{kind: e.Kind(), body: body}:
+	default:
+		log.Errorln("Queue of", t.name, "is full, dropped", e.Kind())
+	}
+}
+
+// Close stops the worker after the queued posts are sent
+func (t *Target) Close() {
+	t.close.Do(func() {
+		close(t.queue)
+	})
+	<-t.done
+}
+
+func (t *Target) wants(e events.Event) bool {
+	if !slices.Contains(t.cfg.Events, e.Kind()) {
+		return false
+	}
+
+	chat, ok := e.(events.ChatPosted)
+	if !ok {
+		return true
+	}
+	if chat.Mode != chatlog.ModeGlobal {
+		return false
+	}
+	if len(t.cfg.Keywords) == 0 {
+		return true
+	}
+
+	txt := strings.ToLower(chat.Txt)
+	for _, k := range t.cfg.Keywords {
+		if strings.Contains(txt, strings.ToLower(k)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Target) render(e events.Event) ([]byte, error) {
+	tmpl, ok := t.templates[e.Kind()]
+	if !ok {
+		return json.Marshal(struct {
+			Event string
+			Data  events.Event
+		}{e.Kind(), e})
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, e); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (t *Target) run() {
+	defer close(t.done)
+
+	for p := range t.queue {
+		delay := t.retryDelay
+
+		for try := 0; ; try++ {
+			retry, err := t.send(p)
+			if err == nil {
+				break
+			}
+			if !retry || try >= t.retries {
+				log.Errorln("Failed to post", p.kind, "to", t.name+":", err)
+				break
+			}
+
+			log.Debugln("Post of", p.kind, "to", t.name, "failed, retrying in", delay, ":", err)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+}
+
+// send posts once, returns if a failure is worth a retry
+func (t *Target) send(p post) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, t.cfg.URL, bytes.NewReader(p.body))
+	if err != nil {
+		return false, t.redact(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, p.kind)
+	if t.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(t.cfg.Secret, p.body))
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return true, t.redact(err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %s", resp.Status)
+	}
+	return false, fmt.Errorf("status %s", resp.Status)
+}
+
+// redact hides the URL in errors of the HTTP client
+func (t *Target) redact(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		ue.URL = t.name
+	}
+	return err
+}
+
+// Sign returns the signature header value of the body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,215 @@
+package webhooks_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"s2dnglobby/config"
+	"s2dnglobby/events"
+	"s2dnglobby/webhooks"
+)
+
+type request struct {
+	event     string
+	signature string
+	body      string
+}
+
+// standIn records the posts it gets, the first failures answer with 500
+type standIn struct {
+	lock     sync.Mutex
+	requests []request
+	failures int
+	block    chan struct{}
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.block != nil {
+		<-s.block
+	}
+	body, _ := io.ReadAll(r.Body)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.requests = append(s.requests, request{
+		event:     r.Header.Get(webhooks.EventHeader),
+		signature: r.Header.Get(webhooks.SignatureHeader),
+		body:      string(body),
+	})
+}
+
+func (s *standIn) got() []request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]request(nil), s.requests...)
+}
+
+var created = events.ServerCreated{Server: events.ServerInfo{Name: "Rome", Host: "caesar", Map: "Alps", MaxPlayers: 4, Players: 1}}
+
+func TestTemplateAndSignature(t *testing.T) {
+	s := &standIn{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	target, err := webhooks.New(config.Webhook{
+		URL:    srv.URL,
+		Events: []string{"ServerCreated", "UserLoggedIn"},
+		Secret: "secret",
+		Templates: map[string]string{
+			"ServerCreated": `{"content": {{json (printf "%s is hosting %s on %s" .Server.Host .Server.Name .Server.Map)}}}`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target.Handle(created)
+	target.Handle(events.UserLoggedOut{Name: "caesar"}) // not selected
+	target.Handle(events.UserLoggedIn{Name: "caesar"})
+	target.Close()
+
+	reqs := s.got()
+	if len(reqs) != 2 {
+		t.Fatalf("got %d posts, want 2", len(reqs))
+	}
+
+	if want := `{"content": "caesar is hosting Rome on Alps"}`; reqs[0].body != want {
+		t.Errorf("got body %s, want %s", reqs[0].body, want)
+	}
+	if reqs[0].signature != webhooks.Sign("secret", []byte(reqs[0].body)) {
+		t.Errorf("invalid signature %s", reqs[0].signature)
+	}
+
+	var def struct {
+		Event string
+		Data  events.UserLoggedIn
+	}
+	if err := json.Unmarshal([]byte(reqs[1].body), &def); err != nil || def.Event != "UserLoggedIn" || def.Data.Name != "caesar" {
+		t.Errorf("unexpected default body %s: %v", reqs[1].body, err)
+	}
+	if reqs[1].event != "UserLoggedIn" {
+		t.Errorf("got event header %s", reqs[1].event)
+	}
+}
+
+func TestChatKeywords(t *testing.T) {
+	s := &standIn{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	target, err := webhooks.New(config.Webhook{
+		URL:      srv.URL,
+		Events:   []string{"ChatPosted"},
+		Keywords: []string{"LFG"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target.Handle(events.ChatPosted{Mode: "global", Txt: "hello"})
+	target.Handle(events.ChatPosted{Mode: "global", Txt: "anyone lfg?"})
+	target.Handle(events.ChatPosted{Mode: "whisper", Txt: "lfg"})
+	target.Close()
+
+	if n := len(s.got()); n != 1 {
+		t.Errorf("got %d posts, want 1", n)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	// two failures before the endpoint accepts the post
+	for _, tt := range []struct {
+		retries  int
+		want     int
+		failures int // not tried anymore
+	}{{2, 1, 0}, {0, 0, 1}} {
+		s := &standIn{failures: 2}
+		srv := httptest.NewServer(s)
+
+		retries := tt.retries
+		target, err := webhooks.New(config.Webhook{
+			URL:          srv.URL,
+			Events:       []string{"ServerCreated"},
+			Retries:      &retries,
+			RetryDelayMs: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		target.Handle(created)
+		target.Close()
+		srv.Close()
+
+		if n := len(s.got()); n != tt.want {
+			t.Errorf("%d retries: got %d posts, want %d", tt.retries, n, tt.want)
+		}
+		s.lock.Lock()
+		if s.failures != tt.failures {
+			t.Errorf("%d retries: %d failures left, want %d", tt.retries, s.failures, tt.failures)
+		}
+		s.lock.Unlock()
+	}
+}
+
+func TestFullQueueDoesNotBlock(t *testing.T) {
+	s := &standIn{block: make(chan struct{})}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	target, err := webhooks.New(config.Webhook{
+		URL:       srv.URL,
+		Events:    []string{"ServerCreated"},
+		QueueSize: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 20; i++ {
+			target.Handle(created)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Handle blocked on a slow endpoint")
+	}
+
+	close(s.block)
+	target.Close()
+
+	// one in flight and two queued
+	if n := len(s.got()); n > 3 {
+		t.Errorf("got %d posts, want at most 3", n)
+	}
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	_, err := webhooks.New(config.Webhook{
+		URL:       "http://localhost/api/webhooks/secret-token",
+		Templates: map[string]string{"ServerCreated": "{{.Server"},
+	})
+	if err == nil {
+		t.Fatal("expected error for invalid template")
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("error reveals the URL: %v", err)
+	}
+}